@@ -1,6 +1,8 @@
 package watchman
 
 import (
+	"time"
+
 	"github.com/sjansen/watchman/protocol"
 )
 
@@ -8,43 +10,89 @@ import (
 type ChangeNotification struct {
 	IsFreshInstance bool
 	Clock           string
-	Subscription    string
-	Files           []File
+	// MergeBase is set for subscriptions using an SCM-aware Query. When
+	// the merge base changes, IsFreshInstance is true and Files lists
+	// every file changed since the new merge base.
+	MergeBase    string
+	Subscription string
+	Files        []File
+
+	// changed is the most recent change time of the Files, according
+	// to the Watchman server, or zero if unknown
+	changed time.Time
 }
 
 func newChangeNotification(sub *protocol.Subscription) *ChangeNotification {
 	clock := sub.Clock()
-	files := sub.Files()
+	files := sub.TypedFiles()
 	cn := &ChangeNotification{
 		IsFreshInstance: sub.IsFreshInstance(),
 		Clock:           clock,
+		MergeBase:       sub.MergeBase(),
 		Subscription:    sub.Subscription(),
-		Files:           make([]File, len(files)),
+		Files:           newFiles(files, clock),
+	}
+	if !cn.IsFreshInstance {
+		cn.changed = lastChanged(files)
+	}
+	return cn
+}
+
+// lastChanged returns the most recent ctime of files that exist. The
+// ctime of a removed file is from before it was removed, so is not
+// used.
+func lastChanged(files []protocol.File) (t time.Time) {
+	var ctime int64
+	for i := range files {
+		if files[i].Exists && files[i].CTime > ctime {
+			ctime = files[i].CTime
+		}
 	}
-	for i, file := range files {
-		f := &cn.Files[i]
-		f.Name = file["name"].(string)
-		f.Type = file["type"].(string)
+	if ctime > 0 {
+		t = time.Unix(ctime, 0)
+	}
+	return
+}
+
+// Filter returns a copy of cn, including only the Files matching e.
+// This allows a broad subscription to be narrowed for each consumer,
+// without creating more subscriptions.
+func (cn *ChangeNotification) Filter(e Expr) *ChangeNotification {
+	filtered := *cn
+	filtered.Files = make([]File, 0, len(cn.Files))
+	for i := range cn.Files {
+		if e.Matches(&cn.Files[i]) {
+			filtered.Files = append(filtered.Files, cn.Files[i])
+		}
+	}
+	return &filtered
+}
+
+func newFiles(files []protocol.File, clock string) []File {
+	result := make([]File, len(files))
+	for i := range files {
+		file, f := &files[i], &result[i]
+		f.Name = file.Name
+		f.Type = file.Type
 		if f.Type == "l" {
-			f.Target = file["symlink_target"].(string)
+			f.Target = file.SymlinkTarget
 		}
-		f.Size = int64(file["size"].(float64))
-		cclock := file["cclock"].(string)
-		exists := file["exists"].(bool)
+		f.Size = file.Size
+		f.ContentSHA1 = file.ContentSHA1
 		switch {
-		case cclock == clock:
-			if exists {
+		case file.CClock == clock:
+			if file.Exists {
 				f.Change = Created
 			} else {
 				f.Change = Ephemeral
 			}
-		case !exists:
+		case !file.Exists:
 			f.Change = Removed
 		default:
 			f.Change = Updated
 		}
 	}
-	return cn
+	return result
 }
 
 // A File represents changes in the state of a single filesystem entry.
@@ -54,6 +102,9 @@ type File struct {
 	Type   string
 	Target string
 	Size   int64
+	// ContentSHA1 is the hex encoded SHA-1 hash of a regular file's
+	// content, if requested using Query.ContentSHA1.
+	ContentSHA1 string
 }
 
 // A StateChange describes how a file's state has changed.
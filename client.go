@@ -1,46 +1,130 @@
 package watchman
 
 import (
+	"context"
+	"errors"
+	"syscall"
+
 	"github.com/sjansen/watchman/protocol"
 )
 
 // Client provides a high-level interface to Watchman.
+//
+// A Client is safe for concurrent use by multiple goroutines. Requests
+// are pipelined over a single connection, and the Watchman server
+// processes them in the order they are sent.
 type Client struct {
-	conn      *protocol.Connection
-	stop      func(bool)
-	requests  chan<- protocol.Request
-	responses <-chan result
-	updates   <-chan interface{}
+	conn     *protocol.Connection
+	loop     *eventloop
+	observer Observer
 }
 
 // Connect connects to or starts the Watchman server and returns a
 // new Client.
-func Connect() (c *Client, err error) {
-	conn, err := protocol.Connect()
+func Connect(opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	conn, err := protocol.Connect(o.connect...)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn, o), nil
+}
+
+// NewClient returns a new Client that uses an existing Connection, for
+// example one created by protocol.NewConnection. The Client takes
+// ownership of conn and closes it when the Client is closed.
+//
+// Options that control how to connect to the server are ignored.
+func NewClient(conn *protocol.Connection, opts ...Option) *Client {
+	return newClient(conn, newOptions(opts))
+}
+
+func newClient(conn *protocol.Connection, o *options) *Client {
+	return &Client{
+		conn:     conn,
+		loop:     startEventLoop(conn, o),
+		observer: o.observer,
+	}
+}
+
+// Do sends an arbitrary request to the Watchman server and returns the
+// raw response. It is intended for commands that do not yet have a
+// dedicated method, and can be combined with protocol.RawRequest.
+//
+// If req implements protocol.CapabilityRequirer and the server lacks a
+// required capability, Do returns a protocol.CapabilityError without
+// sending the request.
+//
+// If ctx is canceled before the response arrives, Do returns ctx.Err().
+// The request may still be processed by the Watchman server.
+func (c *Client) Do(ctx context.Context, req protocol.Request) (protocol.ResponsePDU, error) {
+	pdu, err := c.request(ctx, req)
+	if pdu != nil {
+		pdu.ExpandFiles()
+	}
+	return pdu, err
+}
+
+// request is like Do, but leaves files encoded for TypedFiles.
+func (c *Client) request(ctx context.Context, req protocol.Request) (protocol.ResponsePDU, error) {
+	if err := c.conn.CheckCapabilities(req); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.observer != nil {
+		return observe(c.observer, req, func(stats *RequestStats) (protocol.ResponsePDU, error) {
+			return c.do(ctx, req, stats)
+		})
+	}
+	return c.do(ctx, req, nil)
+}
+
+// do sends a request, and waits for its response. If stats is not nil,
+// the sizes of the request and response are recorded.
+func (c *Client) do(ctx context.Context, req protocol.Request, stats *RequestStats) (protocol.ResponsePDU, error) {
+	call := newCall(req)
+	err := c.loop.send(call)
+	if stats != nil {
+		stats.Sent = call.sent
+	}
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	loop, stop := startEventLoop(conn)
-	c = &Client{
-		conn:      conn,
-		stop:      stop,
-		requests:  loop.requests,
-		responses: loop.responses,
-		updates:   loop.updates,
+	select {
+	case result := <-call.done:
+		if stats != nil {
+			stats.Received = result.received
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		return result.pdu, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return
 }
 
-func (c *Client) send(req protocol.Request) (res protocol.ResponsePDU, err error) {
-	c.requests <- req
-	result := <-c.responses
-	if result.err == nil {
-		res = result.pdu
-	} else {
-		err = result.err
+func (c *Client) send(req protocol.Request) (protocol.ResponsePDU, error) {
+	return c.request(context.Background(), req)
+}
+
+func (c *Client) subscriber() *Client {
+	return c
+}
+
+// closed reports if the connection to the Watchman server is closed.
+func (c *Client) closed() bool {
+	select {
+	case <-c.loop.done:
+		return true
+	default:
+		return false
 	}
-	return
 }
 
 // AddWatch requests that the Watchman server monitor a directory for changes.
@@ -50,23 +134,28 @@ func (c *Client) send(req protocol.Request) (res protocol.ResponsePDU, err error
 //
 // For details, see: https://facebook.github.io/watchman/docs/cmd/watch-project.html
 func (c *Client) AddWatch(path string) (*Watch, error) {
+	return addWatch(c, path)
+}
+
+func addWatch(s sender, path string) (*Watch, error) {
 	req := &protocol.WatchProjectRequest{Path: path}
-	pdu, err := c.send(req)
+	pdu, err := s.send(req)
 	if err != nil {
 		return nil, err
 	}
 
 	res := protocol.NewWatchProjectResponse(pdu)
 	w := &Watch{
-		client: c,
-		root:   res.Watch(),
+		client:   s,
+		root:     res.Watch(),
+		relative: res.RelativePath(),
 	}
 	return w, nil
 }
 
 // Close closes the connection to the Watchman server.
 func (c *Client) Close() error {
-	c.stop(false)
+	c.loop.stop()
 	return nil
 }
 
@@ -78,19 +167,55 @@ func (c *Client) HasCapability(capability string) bool {
 }
 
 // ListWatches returns a list of directories that Watchman is monitoring.
-func (c *Client) ListWatches() (roots []string, err error) {
+func (c *Client) ListWatches() ([]string, error) {
+	return listWatches(c)
+}
+
+func listWatches(s sender) ([]string, error) {
 	req := &protocol.WatchListRequest{}
-	if pdu, err := c.send(req); err == nil {
-		res := protocol.NewWatchListResponse(pdu)
-		roots = res.Roots()
+	pdu, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := protocol.NewWatchListResponse(pdu)
+	return res.Roots(), nil
+}
+
+// PID returns the process ID of the Watchman server.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/get-pid.html
+func (c *Client) PID() (int, error) {
+	pdu, err := c.send(&protocol.GetPIDRequest{})
+	if err != nil {
+		return 0, err
 	}
-	return
+
+	res := protocol.NewGetPIDResponse(pdu)
+	return res.PID(), nil
+}
+
+// Notifications returns a channel that emits Events sent unilaterally
+// by the Watchman server, such as subscription notifications.
+func (c *Client) Notifications() <-chan Event {
+	return c.loop.updates
 }
 
-// Notifications returns a channel that emits unilateral messages
-// from the Watchman server.
-func (c *Client) Notifications() <-chan interface{} {
-	return c.updates
+// ShutdownServer asks the Watchman server to exit. Other clients of
+// the server, including their subscriptions, are also disconnected.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/shutdown-server.html
+func (c *Client) ShutdownServer() error {
+	_, err := c.send(&protocol.ShutdownServerRequest{})
+	switch {
+	case errors.Is(err, ErrClosed),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ECONNRESET):
+		// the server may exit, closing the connection, before its
+		// response is received
+		err = nil
+	}
+	return err
 }
 
 // SockName returns the location of then UNIX domain socket used
@@ -0,0 +1,160 @@
+package watchman
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestNewClient(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "cmd-watch-project", "cmd-watch-list")
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"watch": args[1]}
+	})
+	s.handle("watch-list", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"roots": []string{"/tmp"}}
+	})
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock": "c:1531594843:978:9:1",
+			"files": []interface{}{map[string]interface{}{"name": "foo"}},
+		}
+	})
+
+	c := s.connect()
+	require.Equal("fake", c.SockName())
+	require.Equal("4.9.0", c.Version())
+	require.True(c.HasCapability("cmd-watch-list"))
+	require.False(c.HasCapability("grant-three-wishes"))
+
+	w, err := c.AddWatch("/tmp")
+	require.NoError(err)
+	require.Equal("/tmp", w.Root())
+	require.Equal("", w.RelativePath())
+
+	roots, err := c.ListWatches()
+	require.NoError(err)
+	require.Equal([]string{"/tmp"}, roots)
+
+	pdu, err := c.Do(context.Background(), protocol.RawRequest{"watch-list"})
+	require.NoError(err)
+	require.Equal([]interface{}{"/tmp"}, pdu["roots"])
+
+	// files are decoded the same as by protocol.Connection.Recv
+	pdu, err = c.Do(context.Background(), &protocol.QueryRequest{Root: "/tmp"})
+	require.NoError(err)
+	require.Equal([]interface{}{
+		map[string]interface{}{"name": "foo"},
+	}, pdu["files"])
+
+	_, err = c.Do(context.Background(), protocol.RawRequest{"noop"})
+	require.IsType(&protocol.WatchmanError{}, err)
+
+	_, err = c.Do(context.Background(), &protocol.ClockRequest{
+		Path:        "/tmp",
+		SyncTimeout: 100,
+	})
+	require.IsType(&protocol.CapabilityError{}, err)
+
+	require.NoError(c.Close())
+}
+
+func TestClientDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	c := s.connect()
+	s.close()
+	for range c.Notifications() {
+		continue
+	}
+
+	_, err := c.Do(context.Background(), protocol.RawRequest{"version"})
+	require.Equal(ErrClosed, err)
+
+	require.NoError(c.Close())
+}
+
+func TestServerCommands(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("get-pid", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"pid": 12345}
+	})
+	s.handle("shutdown-server", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"shutdown-server": true}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	pid, err := c.PID()
+	require.NoError(err)
+	require.Equal(12345, pid)
+
+	err = c.ShutdownServer()
+	require.NoError(err)
+}
+
+func TestShutdownServerWithoutResponse(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("shutdown-server", func(args []interface{}) protocol.ResponsePDU {
+		s.close()
+		return nil
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	require.NoError(c.ShutdownServer())
+}
+
+// shutdownConn fails to finish sending shutdown-server, as if the server
+// exited while it was being sent.
+type shutdownConn struct {
+	net.Conn
+	err      error
+	shutdown bool
+}
+
+func (c *shutdownConn) Write(b []byte) (int, error) {
+	if c.shutdown {
+		return 0, &net.OpError{
+			Op:  "write",
+			Net: "unix",
+			Err: os.NewSyscallError("write", c.err),
+		}
+	}
+	c.shutdown = bytes.Contains(b, []byte("shutdown-server"))
+	return c.Conn.Write(b)
+}
+
+func TestShutdownServerConnectionErrors(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.EPIPE, syscall.ECONNRESET} {
+		t.Run(errno.Error(), func(t *testing.T) {
+			s := newFakeServer(t)
+			dial := func(sockname string, timeout time.Duration) (net.Conn, error) {
+				conn, err := s.dial(sockname, timeout)
+				return &shutdownConn{Conn: conn, err: errno}, err
+			}
+
+			c := s.connect(WithDialer(dial))
+			defer c.Close()
+
+			require.NoError(t, c.ShutdownServer())
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Command gowatchman sends a single JSON encoded command to the Watchman
+// server and prints the response, similar to `watchman -j`.
+//
+// The command is read from the command line if present, otherwise from
+// stdin:
+//
+//	gowatchman '["watch-list"]'
+//	echo '["clock", "/path/to/dir"]' | gowatchman
+//
+// With -persistent, the connection is kept open after the response is
+// printed, and unilateral PDUs (such as subscription notifications) are
+// printed as they arrive.
+//
+// With -expr, an expression written in the compact syntax read by
+// watchman.ParseExpr is printed as a JSON encoded Watchman expression,
+// for use in a query or subscription:
+//
+//	gowatchman -expr 'type:f && (suffix:go || suffix:mod) && !dirname:vendor'
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sjansen/watchman"
+	"github.com/sjansen/watchman/protocol"
+)
+
+var (
+	EXPR       = flag.String("expr", "", "print the JSON encoding of a compact expression and exit")
+	PERSISTENT = flag.Bool("persistent", false, "print unilateral PDUs until the connection is closed")
+	PRETTY     = flag.Bool("pretty", true, "indent JSON output")
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [flags] [JSON command]\n\n", os.Args[0],
+		)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+func die(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func parseRequest(r io.Reader) (protocol.RawRequest, error) {
+	var req protocol.RawRequest
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return nil, err
+	}
+	if len(req) < 1 {
+		return nil, errors.New("command must be a non-empty JSON array")
+	}
+	return req, nil
+}
+
+func printExpr(s string) error {
+	e, err := watchman.ParseExpr(s)
+	if err != nil {
+		return err
+	}
+	return printJSON(e.Term())
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if *PRETTY {
+		buffer := &bytes.Buffer{}
+		if err = json.Indent(buffer, b, "", "    "); err != nil {
+			return err
+		}
+		b = buffer.Bytes()
+	}
+	_, err = fmt.Println(string(b))
+	return err
+}
+
+func main() {
+	if *EXPR != "" {
+		if err := printExpr(*EXPR); err != nil {
+			die(err)
+		}
+		return
+	}
+
+	var input io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		input = strings.NewReader(strings.Join(flag.Args(), " "))
+	}
+
+	req, err := parseRequest(input)
+	if err != nil {
+		die(err)
+	}
+
+	c, err := protocol.Connect()
+	if err != nil {
+		die(err)
+	}
+	defer c.Close()
+
+	if err = c.Send(req); err != nil {
+		die(err)
+	}
+
+	for {
+		pdu, err := c.Recv()
+		if e, ok := err.(*protocol.WatchmanError); ok {
+			// print error responses like any other, then fail
+			if err = printJSON(e.PDU()); err != nil {
+				die(err)
+			}
+			os.Exit(1)
+		} else if err != nil {
+			if err == io.EOF {
+				return
+			}
+			die(err)
+		}
+		if err = printJSON(pdu); err != nil {
+			die(err)
+		}
+		if !*PERSISTENT {
+			return
+		}
+	}
+}
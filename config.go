@@ -0,0 +1,81 @@
+package watchman
+
+import (
+	"time"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// A Config represents the settings from the .watchmanconfig file of
+// a watched root.
+//
+// For details, see: https://facebook.github.io/watchman/docs/config.html
+type Config struct {
+	// IgnoreDirs lists directories that Watchman does not watch.
+	IgnoreDirs []string
+	// IgnoreVCS lists version control directories that are only
+	// partially watched.
+	IgnoreVCS []string
+	// Settle is how long the filesystem must be idle before
+	// notifications are sent.
+	Settle time.Duration
+	// IdleReapAge is how long the root can go unqueried before
+	// Watchman stops watching it.
+	IdleReapAge time.Duration
+	// GCAge is how long deleted files are remembered.
+	GCAge time.Duration
+	// GCInterval is how often deleted files are forgotten.
+	GCInterval time.Duration
+	// Raw contains every setting, including those without a
+	// dedicated field.
+	Raw map[string]interface{}
+}
+
+func newConfig(raw map[string]interface{}) *Config {
+	cfg := &Config{
+		IgnoreDirs:  stringsValue(raw["ignore_dirs"]),
+		IgnoreVCS:   stringsValue(raw["ignore_vcs"]),
+		Settle:      durationValue(raw["settle"], time.Millisecond),
+		IdleReapAge: durationValue(raw["idle_reap_age_seconds"], time.Second),
+		GCAge:       durationValue(raw["gc_age_seconds"], time.Second),
+		GCInterval:  durationValue(raw["gc_interval_seconds"], time.Second),
+		Raw:         raw,
+	}
+	return cfg
+}
+
+func durationValue(x interface{}, unit time.Duration) time.Duration {
+	if n, ok := x.(float64); ok {
+		return time.Duration(n * float64(unit))
+	}
+	return 0
+}
+
+func stringsValue(x interface{}) []string {
+	values, ok := x.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Config returns the settings from the .watchmanconfig file of a
+// watched root.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/get-config.html
+func (w *Watch) Config() (*Config, error) {
+	req := &protocol.GetConfigRequest{Path: w.root}
+	pdu, err := w.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := protocol.NewGetConfigResponse(pdu)
+	return newConfig(res.Config()), nil
+}
@@ -0,0 +1,43 @@
+package watchman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestWatchConfig(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("get-config", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"config": map[string]interface{}{
+			"ignore_dirs":           []string{"node_modules", "dist"},
+			"ignore_vcs":            []string{".git"},
+			"settle":                200,
+			"idle_reap_age_seconds": 300,
+			"gc_age_seconds":        43200,
+			"gc_interval_seconds":   86400,
+			"fsevents_latency":      0.5,
+		}}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	cfg, err := w.Config()
+	require.NoError(err)
+	history := s.history()
+	require.Equal([]interface{}{"get-config", "/tmp"}, history[len(history)-1])
+	require.Equal([]string{"node_modules", "dist"}, cfg.IgnoreDirs)
+	require.Equal([]string{".git"}, cfg.IgnoreVCS)
+	require.Equal(200*time.Millisecond, cfg.Settle)
+	require.Equal(5*time.Minute, cfg.IdleReapAge)
+	require.Equal(12*time.Hour, cfg.GCAge)
+	require.Equal(24*time.Hour, cfg.GCInterval)
+	require.Equal(0.5, cfg.Raw["fsevents_latency"])
+}
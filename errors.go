@@ -0,0 +1,7 @@
+package watchman
+
+import "errors"
+
+// ErrClosed is returned when a request is made after the connection
+// to the Watchman server has been closed.
+var ErrClosed = errors.New("watchman: connection closed")
@@ -0,0 +1,202 @@
+package watchman
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxRegexps bounds how many compiled PCRE patterns are cached. Once
+// reached, the cache is emptied.
+const maxRegexps = 256
+
+// regexps caches compiled PCRE patterns, since Expr values are often
+// evaluated against many files.
+var regexps = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+// compile returns the compiled form of a PCRE pattern. Go regular
+// expressions are a subset of PCRE, so some valid patterns fail.
+func compile(pattern string, nocase bool) (*regexp.Regexp, error) {
+	if nocase {
+		pattern = "(?i)" + pattern
+	}
+	regexps.Lock()
+	defer regexps.Unlock()
+	if re, ok := regexps.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexps.m) >= maxRegexps {
+		regexps.m = map[string]*regexp.Regexp{}
+	}
+	regexps.m[pattern] = re
+	return re, nil
+}
+
+// validateExpr reports the first PCRE term in e that cannot be compiled.
+func validateExpr(e Expr) error {
+	switch e := e.(type) {
+	case AllOf:
+		for _, x := range e {
+			if err := validateExpr(x); err != nil {
+				return err
+			}
+		}
+	case AnyOf:
+		for _, x := range e {
+			if err := validateExpr(x); err != nil {
+				return err
+			}
+		}
+	case Not:
+		return validateExpr(e.Expr)
+	case PCRE:
+		if _, err := compile(e.Pattern, e.NoCase); err != nil {
+			return fmt.Errorf("invalid pcre %q: %w", e.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// exists reports whether a file exists after a change.
+func exists(f *File) bool {
+	return f.Change != Removed && f.Change != Ephemeral
+}
+
+// subject returns the name compared by a term.
+func subject(f *File, wholename bool) string {
+	if wholename {
+		return f.Name
+	}
+	return path.Base(f.Name)
+}
+
+// Matches reports whether f matches every sub-expression.
+func (e AllOf) Matches(f *File) bool {
+	for _, x := range e {
+		if !x.Matches(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether f matches at least one sub-expression.
+func (e AnyOf) Matches(f *File) bool {
+	for _, x := range e {
+		if x.Matches(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether f does not match the sub-expression.
+func (e Not) Matches(f *File) bool {
+	return !e.Expr.Matches(f)
+}
+
+// Matches always returns true.
+func (True) Matches(f *File) bool {
+	return true
+}
+
+// Matches always returns false.
+func (False) Matches(f *File) bool {
+	return false
+}
+
+// Matches reports whether f exists.
+func (Exists) Matches(f *File) bool {
+	return exists(f)
+}
+
+// Matches reports whether f is an existing empty file or directory.
+func (Empty) Matches(f *File) bool {
+	return exists(f) && (f.Type == "f" || f.Type == "d") && f.Size == 0
+}
+
+// Matches reports whether the name of f matches the pattern.
+func (e Match) Matches(f *File) bool {
+	return wildmatch(
+		e.Pattern, subject(f, e.Wholename),
+		e.Wholename, !e.IncludeDotFiles, e.NoCase,
+	)
+}
+
+// Matches reports whether the name of f matches the regular expression.
+func (e PCRE) Matches(f *File) bool {
+	// patterns that cannot be compiled, which are rejected by
+	// ParseExpr and by queries, never match
+	re, err := compile(e.Pattern, e.NoCase)
+	return err == nil && re.MatchString(subject(f, e.Wholename))
+}
+
+// Matches reports whether the name of f is one of Names.
+func (e Name) Matches(f *File) bool {
+	name := subject(f, e.Wholename)
+	for _, x := range e.Names {
+		if name == x || (e.NoCase && strings.EqualFold(name, x)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether f is within the directory.
+func (e DirName) Matches(f *File) bool {
+	if e.Path == "" {
+		return true
+	}
+	dir, name := e.Path+"/", f.Name
+	if e.NoCase {
+		dir, name = strings.ToLower(dir), strings.ToLower(name)
+	}
+	return strings.HasPrefix(name, dir)
+}
+
+// Matches reports whether the name of f ends with one of Suffixes.
+func (e Suffix) Matches(f *File) bool {
+	name := strings.ToLower(path.Base(f.Name))
+	for _, suffix := range e.Suffixes {
+		if strings.HasSuffix(name, "."+strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether f has the type.
+func (e Type) Matches(f *File) bool {
+	return f.Type == e.Type
+}
+
+// Matches reports whether f exists, and its size satisfies the comparison.
+func (e Size) Matches(f *File) bool {
+	if !exists(f) {
+		return false
+	}
+	switch e.Op {
+	case Eq:
+		return f.Size == e.Value
+	case Ne:
+		return f.Size != e.Value
+	case Gt:
+		return f.Size > e.Value
+	case Ge:
+		return f.Size >= e.Value
+	case Lt:
+		return f.Size < e.Value
+	case Le:
+		return f.Size <= e.Value
+	}
+	return false
+}
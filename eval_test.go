@@ -0,0 +1,96 @@
+package watchman
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprMatches(t *testing.T) {
+	main := &File{Change: Updated, Name: "cmd/app/main.go", Type: "f", Size: 1024}
+	dotfile := &File{Change: Created, Name: ".gitignore", Type: "f", Size: 0}
+	removed := &File{Change: Removed, Name: "vendor/x/x.GO", Type: "f", Size: 0}
+	dir := &File{Change: Updated, Name: "docs", Type: "d", Size: 0}
+
+	for _, tc := range []struct {
+		expr     string
+		expected []*File
+	}{
+		{"true", []*File{main, dotfile, removed, dir}},
+		{"false", nil},
+		{"exists", []*File{main, dotfile, dir}},
+		{"empty", []*File{dotfile, dir}},
+		{"type:f", []*File{main, dotfile, removed}},
+		{"!type:f", []*File{dir}},
+		{"suffix:go", []*File{main, removed}},
+		{"match:*.go", []*File{main}},
+		{"imatch:*.go", []*File{main, removed}},
+		{"match:*", []*File{main, removed, dir}},
+		{"match.dotfiles:*", []*File{main, dotfile, removed, dir}},
+		{"match.wholename:cmd/*.go", nil},
+		{"match.wholename:cmd/**/*.go", []*File{main}},
+		{`pcre:"^\\.git"`, []*File{dotfile}},
+		{"ipcre.wholename:^VENDOR/", []*File{removed}},
+		{"name:docs,.gitignore", []*File{dotfile, dir}},
+		{"name:main.go || name.wholename:main.go", []*File{main}},
+		{"iname.wholename:CMD/APP/MAIN.GO", []*File{main}},
+		{"dirname:cmd", []*File{main}},
+		{"dirname:cmd/app", []*File{main}},
+		{"dirname:cm", nil},
+		{"idirname:VENDOR", []*File{removed}},
+		{"size:>100", []*File{main}},
+		{"size:=0", []*File{dotfile, dir}},
+		{"size:<=1024 && !size:0", []*File{main}},
+		{
+			"type:f && (suffix:go || suffix:mod) && !dirname:vendor",
+			[]*File{main},
+		},
+	} {
+		e, err := ParseExpr(tc.expr)
+		require.NoError(t, err)
+
+		var actual []*File
+		for _, f := range []*File{main, dotfile, removed, dir} {
+			if e.Matches(f) {
+				actual = append(actual, f)
+			}
+		}
+		require.Equal(t, tc.expected, actual, tc.expr)
+	}
+}
+
+func TestChangeNotificationFilter(t *testing.T) {
+	require := require.New(t)
+
+	cn := &ChangeNotification{
+		Clock:        "c:1531594843:978:9:2",
+		Subscription: "sub1",
+		Files: []File{
+			{Change: Created, Name: "main.go", Type: "f"},
+			{Change: Created, Name: "README.md", Type: "f"},
+		},
+	}
+	filtered := cn.Filter(Suffix{Suffixes: []string{"go"}})
+	require.Equal(&ChangeNotification{
+		Clock:        "c:1531594843:978:9:2",
+		Subscription: "sub1",
+		Files: []File{
+			{Change: Created, Name: "main.go", Type: "f"},
+		},
+	}, filtered)
+	require.Len(cn.Files, 2)
+}
+
+func TestRegexpCacheIsBounded(t *testing.T) {
+	require := require.New(t)
+
+	for i := 0; i < maxRegexps*2; i++ {
+		re, err := compile(fmt.Sprintf("^file%d$", i), false)
+		require.NoError(err)
+		require.True(re.MatchString(fmt.Sprintf("file%d", i)))
+	}
+	regexps.Lock()
+	defer regexps.Unlock()
+	require.LessOrEqual(len(regexps.m), maxRegexps)
+}
@@ -0,0 +1,148 @@
+package watchman
+
+import "github.com/sjansen/watchman/protocol"
+
+// An Event is a unilateral message from the Watchman server, or a
+// notice about one, delivered without being requested. The set of
+// Event types is closed:
+//
+//	*ChangeNotification
+//	*SubscriptionCanceled
+//	*StateEnter
+//	*StateLeave
+//	*OverflowNotification
+//	*Unknown
+//
+// Events can be routed to a function for each type using EventHandlers.
+// Server log messages are not Events, and are received separately using
+// SubscribeLogs.
+type Event interface {
+	event()
+}
+
+func (*ChangeNotification) event()   {}
+func (*SubscriptionCanceled) event() {}
+func (*StateEnter) event()           {}
+func (*StateLeave) event()           {}
+func (*OverflowNotification) event() {}
+func (*Unknown) event()              {}
+
+// A SubscriptionCanceled is sent when the Watchman server cancels a
+// subscription, for example because its root is no longer watched. No
+// more notifications are sent for the subscription.
+type SubscriptionCanceled struct {
+	Subscription string
+}
+
+// A StateEnter is sent to a subscription when a client enters a state
+// using the state-enter command, such as while a source control update
+// is in progress.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/state-enter.html
+type StateEnter struct {
+	Subscription string
+	State        string
+	Clock        string
+	// Metadata is the value, if any, passed to the state-enter command.
+	Metadata interface{}
+}
+
+// A StateLeave is sent to a subscription when a client leaves a state
+// using the state-leave command.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/state-leave.html
+type StateLeave struct {
+	Subscription string
+	State        string
+	Clock        string
+	// Metadata is the value, if any, passed to the state-leave command.
+	Metadata interface{}
+	// Abandoned is true if the client that entered the state
+	// disconnected without leaving it.
+	Abandoned bool
+}
+
+// An Unknown is a unilateral PDU not recognized by the Client.
+type Unknown struct {
+	PDU protocol.ResponsePDU
+}
+
+func translateUnilateralPDU(pdu protocol.ResponsePDU) Event {
+	if _, ok := pdu["subscription"]; !ok {
+		pdu.ExpandFiles()
+		return &Unknown{PDU: pdu}
+	}
+
+	sub := protocol.NewSubscription(pdu)
+	switch {
+	case sub.IsCanceled():
+		return &SubscriptionCanceled{
+			Subscription: sub.Subscription(),
+		}
+	case sub.StateEnter() != "":
+		return &StateEnter{
+			Subscription: sub.Subscription(),
+			State:        sub.StateEnter(),
+			Clock:        sub.Clock(),
+			Metadata:     sub.Metadata(),
+		}
+	case sub.StateLeave() != "":
+		return &StateLeave{
+			Subscription: sub.Subscription(),
+			State:        sub.StateLeave(),
+			Clock:        sub.Clock(),
+			Metadata:     sub.Metadata(),
+			Abandoned:    sub.IsAbandoned(),
+		}
+	}
+	return newChangeNotification(sub)
+}
+
+// EventHandlers routes each Event to the function for its type. Events
+// are ignored if the function for their type is nil.
+type EventHandlers struct {
+	Change     func(*ChangeNotification)
+	Canceled   func(*SubscriptionCanceled)
+	StateEnter func(*StateEnter)
+	StateLeave func(*StateLeave)
+	Overflow   func(*OverflowNotification)
+	Unknown    func(*Unknown)
+}
+
+// Handle calls the function for the type of e.
+func (h *EventHandlers) Handle(e Event) {
+	switch e := e.(type) {
+	case *ChangeNotification:
+		if h.Change != nil {
+			h.Change(e)
+		}
+	case *SubscriptionCanceled:
+		if h.Canceled != nil {
+			h.Canceled(e)
+		}
+	case *StateEnter:
+		if h.StateEnter != nil {
+			h.StateEnter(e)
+		}
+	case *StateLeave:
+		if h.StateLeave != nil {
+			h.StateLeave(e)
+		}
+	case *OverflowNotification:
+		if h.Overflow != nil {
+			h.Overflow(e)
+		}
+	case *Unknown:
+		if h.Unknown != nil {
+			h.Unknown(e)
+		}
+	}
+}
+
+// Run calls Handle for every Event received from events, until events
+// is closed.
+func (h *EventHandlers) Run(events <-chan Event) {
+	for e := range events {
+		h.Handle(e)
+	}
+}
@@ -0,0 +1,113 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestTranslateUnilateralPDU(t *testing.T) {
+	for _, tc := range []struct {
+		pdu      protocol.ResponsePDU
+		expected Event
+	}{
+		{
+			pdu: protocol.ResponsePDU{
+				"unilateral":   true,
+				"subscription": "sub1",
+				"clock":        "c:1531594843:978:9:2",
+				"files":        []interface{}{},
+			},
+			expected: &ChangeNotification{
+				Clock:        "c:1531594843:978:9:2",
+				Subscription: "sub1",
+				Files:        []File{},
+			},
+		},
+		{
+			pdu: protocol.ResponsePDU{
+				"unilateral":   true,
+				"subscription": "sub1",
+				"root":         "/tmp",
+				"canceled":     true,
+			},
+			expected: &SubscriptionCanceled{Subscription: "sub1"},
+		},
+		{
+			pdu: protocol.ResponsePDU{
+				"unilateral":   true,
+				"subscription": "sub1",
+				"clock":        "c:1531594843:978:9:3",
+				"state-enter":  "hg.update",
+				"metadata":     map[string]interface{}{"rev": "abc123"},
+			},
+			expected: &StateEnter{
+				Subscription: "sub1",
+				State:        "hg.update",
+				Clock:        "c:1531594843:978:9:3",
+				Metadata:     map[string]interface{}{"rev": "abc123"},
+			},
+		},
+		{
+			pdu: protocol.ResponsePDU{
+				"unilateral":   true,
+				"subscription": "sub1",
+				"clock":        "c:1531594843:978:9:4",
+				"state-leave":  "hg.update",
+				"abandoned":    true,
+			},
+			expected: &StateLeave{
+				Subscription: "sub1",
+				State:        "hg.update",
+				Clock:        "c:1531594843:978:9:4",
+				Abandoned:    true,
+			},
+		},
+		{
+			pdu: protocol.ResponsePDU{
+				"unilateral": true,
+				"echo":       "Spoon!",
+			},
+			expected: &Unknown{PDU: protocol.ResponsePDU{
+				"unilateral": true,
+				"echo":       "Spoon!",
+			}},
+		},
+	} {
+		require.Equal(t, tc.expected, translateUnilateralPDU(tc.pdu))
+	}
+}
+
+func TestEventHandlers(t *testing.T) {
+	require := require.New(t)
+
+	var handled []string
+	h := &EventHandlers{
+		Change: func(cn *ChangeNotification) {
+			handled = append(handled, "change "+cn.Subscription)
+		},
+		StateEnter: func(e *StateEnter) {
+			handled = append(handled, "enter "+e.State)
+		},
+		StateLeave: func(e *StateLeave) {
+			handled = append(handled, "leave "+e.State)
+		},
+	}
+
+	events := make(chan Event, 5)
+	events <- &StateEnter{State: "hg.update"}
+	events <- &ChangeNotification{Subscription: "sub1"}
+	events <- &StateLeave{State: "hg.update"}
+	events <- &SubscriptionCanceled{Subscription: "sub1"}
+	events <- &Unknown{}
+	close(events)
+	h.Run(events)
+
+	require.Equal([]string{
+		"enter hg.update",
+		"change sub1",
+		"leave hg.update",
+	}, handled)
+}
@@ -1,138 +1,382 @@
 package watchman
 
 import (
-	"runtime"
+	"io"
+	"log/slog"
+	"sync"
 
 	"github.com/sjansen/watchman/protocol"
 )
 
+// The eventloop multiplexes requests from many goroutines onto a single
+// connection. Watchman processes commands in the order received, so
+// responses are matched to requests using a FIFO of pending calls.
+// Unilateral PDUs are routed to the logs and updates channels.
 type eventloop struct {
-	requests  chan<- protocol.Request
-	responses <-chan result
-	updates   <-chan interface{}
+	conn     *protocol.Connection
+	logger   *slog.Logger
+	observer Observer
+	warner   *warner
+
+	// writer serializes sending a request and queueing its call, so
+	// that the order of pending matches the order on the wire.
+	writer sync.Mutex
+
+	mu      sync.Mutex
+	closed  bool
+	pending []*call
+	queues  map[string]*queue
+	wg      sync.WaitGroup // forwarders
+
+	// logQueue buffers server log messages, and otherQueue buffers
+	// notifications for subscriptions that were not registered, so
+	// that reading them never delays responses
+	logQueue   *queue
+	otherQueue *queue
+	logs       chan LogEntry
+	updates    chan Event
+
+	done     chan struct{}
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+type call struct {
+	req  protocol.Request
+	done chan result
+	// sent is the size of the encoded request, in bytes
+	sent int
 }
 
 type result struct {
-	err *protocol.WatchmanError
+	err error
 	pdu protocol.ResponsePDU
+	// received is the size of the encoded response, in bytes
+	received int
 }
 
-func reader(conn *protocol.Connection) <-chan result {
-	ch := make(chan result)
-	go func() {
-		defer close(ch)
-
-		for {
-			pdu, err := conn.Recv()
-			result := result{}
-			if err == nil {
-				result.pdu = pdu
-			} else if e, ok := err.(*protocol.WatchmanError); ok {
-				result.err = e
-			} else {
-				return
-			}
-			ch <- result
-		}
-	}()
-	return ch
+func newCall(req protocol.Request) *call {
+	return &call{
+		req: req,
+		// buffered so the eventloop never blocks on an abandoned call
+		done: make(chan result, 1),
+	}
 }
 
-func startEventLoop(conn *protocol.Connection) (l *eventloop, stop func(bool)) {
+func startEventLoop(conn *protocol.Connection, o *options) *eventloop {
 	/* SHUTDOWN
-	requests:    closed by caller/stop()
-	responses:   closed locally
+	quit:        closed by stop()
+	done:        closed locally
+	logs:        closed locally
 	updates:     closed locally
 	*/
 
-	recv := reader(conn)
-	requests := make(chan protocol.Request)
-	responses := make(chan result)
-	updates := make(chan interface{})
-	l = &eventloop{
-		requests:  requests,
-		responses: responses,
-		updates:   updates,
+	l := &eventloop{
+		conn:       conn,
+		logger:     protocol.NewLogger(o.logHandler),
+		observer:   o.observer,
+		warner:     o.warner,
+		queues:     map[string]*queue{},
+		logQueue:   newQueue("log", logBufferSize, DropOldest),
+		otherQueue: newQueue("", otherBufferSize, DropOldest),
+		logs:       make(chan LogEntry),
+		updates:    make(chan Event),
+		done:       make(chan struct{}),
+		quit:       make(chan struct{}),
 	}
+	l.wg.Add(2)
+	go l.forwardLogs()
+	go l.forwardOther()
+	go l.run()
+	return l
+}
 
-	expectRequest := func() (ok bool) {
-		for {
-			select {
-			case req, ok := <-requests:
-				if ok {
-					err := conn.Send(req)
-					ok = err == nil
-				}
-				return ok
-			case result, ok := <-recv:
-				if ok {
-					updates <- translateUnilateralPDU(result.pdu)
-				} else {
-					return false
-				}
-			}
+// forwardLogs delivers buffered log messages to the logs channel.
+func (l *eventloop) forwardLogs() {
+	defer l.wg.Done()
+	for {
+		e, ok := l.logQueue.pop()
+		if !ok {
+			return
 		}
-	}
-
-	expectResponse := func() (ok bool) {
-		for result := range recv {
-			if result.err == nil && result.pdu.IsUnilateral() {
-				updates <- translateUnilateralPDU(result.pdu)
-			} else {
-				responses <- result
-				return true
-			}
+		select {
+		case l.logs <- e.(queuedLog).LogEntry:
+		case <-l.quit:
+			return
 		}
-		return false
 	}
+}
 
-	// Close and empty channels so that other goroutines can shutdown.
-	// IMPORTANT: delayClose should normally be false. It is useful in
-	// tests that would be invalidated by closing `requests` too early.
-	stop = func(delayClose bool) {
-		if !delayClose {
-			close(requests)
-		}
-		for range responses {
-			continue
-		}
-		for range updates {
-			continue
+// otherBufferSize is how many notifications are buffered for
+// subscriptions that were not made using Watch.SubscribeChanges.
+const otherBufferSize = 256
+
+// forwardOther delivers buffered notifications for unregistered
+// subscriptions to the updates channel.
+func (l *eventloop) forwardOther() {
+	defer l.wg.Done()
+	for {
+		e, ok := l.otherQueue.pop()
+		if !ok {
+			return
 		}
-		if delayClose {
-			close(requests)
+		select {
+		case l.updates <- e:
+		case <-l.quit:
+			return
 		}
-		// allow other goroutines to run their shutdown logic;
-		// avoid false positives in tests to detect leaks
-		runtime.Gosched()
 	}
+}
+
+// send writes a request to the Watchman server, and queues the call
+// to receive the matching response.
+func (l *eventloop) send(c *call) error {
+	l.writer.Lock()
+	defer l.writer.Unlock()
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	l.pending = append(l.pending, c)
+	l.mu.Unlock()
+
+	n, err := l.conn.SendN(c.req)
+	c.sent = n
+	if err != nil {
+		// The connection is no longer usable. Closing it causes
+		// run() to exit and fail every pending call.
+		l.conn.Close()
+		return err
+	}
+	return nil
+}
 
+// load returns the number of requests awaiting a response.
+func (l *eventloop) load() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending)
+}
+
+// register routes notifications for a subscription through q, and
+// starts a goroutine to forward them to the updates channel, or to the
+// handler of q.
+func (l *eventloop) register(q *queue) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old, ok := l.queues[q.name]; ok {
+		old.close()
+	}
+	if l.closed {
+		q.close()
+		return
+	}
+	l.queues[q.name] = q
+
+	l.wg.Add(1)
 	go func() {
-		defer func() {
-			conn.Close()
-			close(responses)
-			close(updates)
-			for range requests {
-				continue
-			}
-		}()
+		defer l.wg.Done()
+		if q.stopped != nil {
+			defer func() {
+				if l.stopping() {
+					q.stopped()
+				}
+			}()
+		}
 		for {
-			if ok := expectRequest(); !ok {
+			x, ok := q.popQueued()
+			if !ok {
 				return
 			}
-			if ok := expectResponse(); !ok {
-				return
+			l.observeQueue(q)
+			if q.deliveryFilter != nil {
+				if x.item = q.deliveryFilter(x.item); x.item == nil {
+					continue
+				}
+			}
+			if q.handler != nil {
+				q.handler(x.item, l.quit)
+			} else {
+				select {
+				case l.updates <- x.item:
+				case <-l.quit:
+					return
+				}
+			}
+			if l.observer != nil {
+				l.observer.NotificationDelivered(q.name, x.lag())
 			}
 		}
 	}()
+}
+
+// stopping reports if the connection is being closed, or was lost.
+func (l *eventloop) stopping() bool {
+	select {
+	case <-l.quit:
+		return true
+	default:
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// unregister stops routing notifications through q.
+func (l *eventloop) unregister(q *queue) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.queues[q.name] == q {
+		delete(l.queues, q.name)
+	}
+	q.close()
+}
+
+// stop closes the connection and waits for run() to exit.
+func (l *eventloop) stop() {
+	l.stopOnce.Do(func() {
+		close(l.quit)
+		l.conn.Close()
+
+		l.mu.Lock()
+		for _, q := range l.queues {
+			q.close()
+		}
+		l.mu.Unlock()
+	})
+	<-l.done
+}
+
+func (l *eventloop) run() {
+	defer l.shutdown()
+
+	for {
+		pdu, n, err := l.conn.RecvRawFiles()
+		switch {
+		case err == nil && pdu.IsUnilateral():
+			l.dispatch(pdu)
+		case err == nil:
+			l.complete(result{pdu: pdu, received: n})
+		default:
+			if e, ok := err.(*protocol.WatchmanError); ok {
+				l.complete(result{err: e, received: n})
+			} else {
+				l.disconnected(err)
+				return
+			}
+		}
+	}
+}
 
-	return
+// disconnected logs why run() is exiting.
+func (l *eventloop) disconnected(err error) {
+	select {
+	case <-l.quit:
+		l.logger.Debug("connection closed by client")
+		return
+	default:
+	}
+	if err == io.EOF {
+		l.logger.Info("connection closed by server")
+	} else {
+		l.logger.Warn("connection lost", slog.Any("error", err))
+	}
+}
+
+func (l *eventloop) complete(r result) {
+	l.mu.Lock()
+	if len(l.pending) < 1 {
+		// unexpected response
+		l.mu.Unlock()
+		return
+	}
+	c := l.pending[0]
+	l.pending[0] = nil
+	l.pending = l.pending[1:]
+	l.mu.Unlock()
+
+	if r.pdu != nil {
+		l.warner.warn(command(c.req), r.pdu)
+	}
+	c.done <- r
 }
 
-func translateUnilateralPDU(pdu protocol.ResponsePDU) interface{} {
+// dispatch routes a unilateral PDU to a queue. It never blocks, so
+// that a slow consumer cannot delay responses.
+func (l *eventloop) dispatch(pdu protocol.ResponsePDU) {
+	if pdu.IsLog() {
+		l.logger.Debug("routing unilateral PDU", slog.String("destination", "logs"))
+		l.logQueue.push(queuedLog{newLogEntry(protocol.NewLog(pdu))})
+		return
+	}
+
+	if name, ok := pdu["subscription"].(string); ok {
+		l.mu.Lock()
+		q := l.queues[name]
+		l.mu.Unlock()
+		if q != nil {
+			l.logger.Debug("routing unilateral PDU",
+				slog.String("destination", "subscription"),
+				slog.String("subscription", name),
+			)
+			l.warner.warn("subscribe", pdu)
+			_, dropped := q.stats()
+			q.push(translateUnilateralPDU(pdu))
+			l.observeQueue(q)
+			if _, total := q.stats(); total != dropped && l.observer != nil {
+				l.observer.NotificationsDropped(q.name, total)
+			}
+			return
+		}
+	}
+
+	l.logger.Debug("routing unilateral PDU",
+		slog.String("destination", "notifications"),
+	)
 	if _, ok := pdu["subscription"]; ok {
-		sub := protocol.NewSubscription(pdu)
-		return newChangeNotification(sub)
+		l.warner.warn("subscribe", pdu)
+	}
+	_, dropped := l.otherQueue.stats()
+	l.otherQueue.push(translateUnilateralPDU(pdu))
+	if _, total := l.otherQueue.stats(); total != dropped {
+		l.logger.Warn("dropped unread notification",
+			slog.Uint64("dropped", total),
+		)
+	}
+}
+
+// observeQueue reports the depth of q to the observer.
+func (l *eventloop) observeQueue(q *queue) {
+	if l.observer != nil {
+		depth, _ := q.stats()
+		l.observer.QueueDepth(q.name, depth)
 	}
-	return pdu
+}
+
+func (l *eventloop) shutdown() {
+	l.mu.Lock()
+	l.closed = true
+	pending := l.pending
+	l.pending = nil
+	for _, q := range l.queues {
+		q.close()
+	}
+	l.logQueue.close()
+	l.otherQueue.close()
+	l.mu.Unlock()
+
+	for _, c := range pending {
+		c.done <- result{err: ErrClosed}
+	}
+
+	l.conn.Close()
+	// forwarders deliver buffered notifications before updates is closed
+	l.wg.Wait()
+	close(l.logs)
+	close(l.updates)
+	close(l.done)
 }
@@ -0,0 +1,141 @@
+package watchman
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestPipelinedRequests(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("echo", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"echo": args[1]}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pdu, err := c.Do(context.Background(), protocol.RawRequest{"echo", i})
+			if err != nil {
+				errs <- err
+			} else if pdu["echo"] != float64(i) {
+				errs <- &protocol.WatchmanError{}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(err)
+	}
+}
+
+func TestCanceledRequest(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("echo", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"echo": args[1]}
+	})
+	s.handle("sleep", func(args []interface{}) protocol.ResponsePDU {
+		time.Sleep(50 * time.Millisecond)
+		return protocol.ResponsePDU{"sleep": true}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := c.Do(ctx, protocol.RawRequest{"sleep"})
+	require.Equal(context.DeadlineExceeded, err)
+
+	_, err = c.Do(ctx, protocol.RawRequest{"echo", "too late"})
+	require.Equal(context.DeadlineExceeded, err)
+
+	pdu, err := c.Do(context.Background(), protocol.RawRequest{"echo", "Spoon!"})
+	require.NoError(err)
+	require.Equal("Spoon!", pdu["echo"])
+}
+
+func TestUnilateralBetweenResponses(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("echo", func(args []interface{}) protocol.ResponsePDU {
+		s.send(protocol.ResponsePDU{"unilateral": true, "echo": args[1]})
+		return protocol.ResponsePDU{"echo": args[1]}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	updates := make(chan Event, 1)
+	go func() {
+		for update := range c.Notifications() {
+			updates <- update
+		}
+		close(updates)
+	}()
+
+	pdu, err := c.Do(context.Background(), protocol.RawRequest{"echo", "Spoon!"})
+	require.NoError(err)
+	require.Equal("Spoon!", pdu["echo"])
+	require.Equal(&Unknown{PDU: protocol.ResponsePDU{
+		"echo":       "Spoon!",
+		"unilateral": true,
+	}}, <-updates)
+
+	require.NoError(c.Close())
+	_, err = c.Do(context.Background(), protocol.RawRequest{"echo", "Spoon!"})
+	require.Equal(ErrClosed, err)
+	_, ok := <-updates
+	require.False(ok)
+}
+
+func TestUnregisteredDoNotBlockResponses(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("echo", func(args []interface{}) protocol.ResponsePDU {
+		for i := 0; i < otherBufferSize+10; i++ {
+			s.send(protocol.ResponsePDU{
+				"unilateral":   true,
+				"subscription": "unregistered",
+				"clock":        fmt.Sprintf("c:1531594843:978:9:%d", i),
+				"files":        []interface{}{},
+			})
+		}
+		return protocol.ResponsePDU{"echo": args[1]}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	// requests are not blocked by unread notifications
+	pdu, err := c.Do(context.Background(), protocol.RawRequest{"echo", "Spoon!"})
+	require.NoError(err)
+	require.Equal("Spoon!", pdu["echo"])
+
+	// the newest notifications are kept
+	last := fmt.Sprintf("c:1531594843:978:9:%d", otherBufferSize+9)
+	for e := range c.Notifications() {
+		if e.(*ChangeNotification).Clock == last {
+			break
+		}
+	}
+}
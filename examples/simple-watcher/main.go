@@ -108,40 +108,42 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for n := range c.Notifications() {
-			cn, ok := n.(*watchman.ChangeNotification)
-			if !ok || cn.IsFreshInstance {
-				continue
-			}
-			fmt.Printf(
-				"Update: (clock=%q)\n",
-				cn.Clock,
-			)
-			files := cn.Files
-			sort.Sort(byTypeAndName(files))
-			for _, file := range files {
-				switch file.Type {
-				case "d":
-					fmt.Printf("  %9s  %s/\n",
-						file.Change, file.Name,
-					)
-				case "l":
-					fmt.Printf("  %9s  %s -> %s\n",
-						file.Change, file.Name, file.Target,
-					)
-				default:
-					fmt.Printf("  %9s  %s\n",
-						file.Change, file.Name,
-					)
-				}
-			}
-			fmt.Println()
-		}
+		handlers := &watchman.EventHandlers{Change: printChanges}
+		handlers.Run(c.Notifications())
 	}()
 
-	if _, err = watch.Subscribe("example", dir); err != nil {
+	if _, err = watch.SubscribeChanges("example"); err != nil {
 		die(err)
 	}
 
 	wg.Wait()
 }
+
+func printChanges(cn *watchman.ChangeNotification) {
+	if cn.IsFreshInstance {
+		return
+	}
+	fmt.Printf(
+		"Update: (clock=%q)\n",
+		cn.Clock,
+	)
+	files := cn.Files
+	sort.Sort(byTypeAndName(files))
+	for _, file := range files {
+		switch file.Type {
+		case "d":
+			fmt.Printf("  %9s  %s/\n",
+				file.Change, file.Name,
+			)
+		case "l":
+			fmt.Printf("  %9s  %s -> %s\n",
+				file.Change, file.Name, file.Target,
+			)
+		default:
+			fmt.Printf("  %9s  %s\n",
+				file.Change, file.Name,
+			)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,332 @@
+package watchman
+
+import (
+	"strconv"
+	"strings"
+)
+
+// An Expr is a Watchman expression term, used to filter the files
+// returned by a Query or Subscription. Expressions can be built from
+// the types below, or parsed from a compact syntax using ParseExpr.
+//
+// For details, see: https://facebook.github.io/watchman/docs/expr/allof.html
+type Expr interface {
+	// Matches evaluates the expression against a file, the same way as
+	// the Watchman server.
+	Matches(f *File) bool
+	// String returns the expression using the syntax read by ParseExpr.
+	String() string
+	// Term returns the expression as used by the Watchman protocol.
+	Term() []interface{}
+}
+
+// AllOf matches files matched by every sub-expression.
+type AllOf []Expr
+
+// AnyOf matches files matched by at least one sub-expression.
+type AnyOf []Expr
+
+// Not matches files not matched by its sub-expression.
+type Not struct {
+	Expr Expr
+}
+
+// True matches every file.
+type True struct{}
+
+// False matches no files.
+type False struct{}
+
+// Exists matches files that exist.
+type Exists struct{}
+
+// Empty matches empty files and directories.
+type Empty struct{}
+
+// Match matches file names using a wildmatch pattern. The pattern is
+// compared to the base name, or the whole name relative to the root
+// when Wholename is true.
+type Match struct {
+	Pattern         string
+	Wholename       bool
+	NoCase          bool
+	IncludeDotFiles bool
+}
+
+// PCRE matches file names using a Perl compatible regular expression.
+// Only the subset of PCRE supported by the regexp package can be
+// matched locally.
+type PCRE struct {
+	Pattern   string
+	Wholename bool
+	NoCase    bool
+}
+
+// Name matches file names exactly.
+type Name struct {
+	Names     []string
+	Wholename bool
+	NoCase    bool
+}
+
+// DirName matches files within a directory, at any depth.
+type DirName struct {
+	Path   string
+	NoCase bool
+}
+
+// Suffix matches file names ending with a period and one of Suffixes.
+// Suffixes are compared without regard to case.
+type Suffix struct {
+	Suffixes []string
+}
+
+// Type matches files of a type, such as "f" for regular files, "d" for
+// directories, or "l" for symbolic links.
+type Type struct {
+	Type string
+}
+
+// Size matches files using a comparison with their size in bytes.
+type Size struct {
+	Op    SizeOp
+	Value int64
+}
+
+// A SizeOp compares file sizes.
+type SizeOp string
+
+// Operators used by Size expressions.
+const (
+	Eq SizeOp = "eq"
+	Ne SizeOp = "ne"
+	Gt SizeOp = "gt"
+	Ge SizeOp = "ge"
+	Lt SizeOp = "lt"
+	Le SizeOp = "le"
+)
+
+var sizeOpSymbols = map[SizeOp]string{
+	Eq: "=", Ne: "!=", Gt: ">", Ge: ">=", Lt: "<", Le: "<=",
+}
+
+func scope(wholename bool) string {
+	if wholename {
+		return "wholename"
+	}
+	return "basename"
+}
+
+func prefix(nocase bool, name string) string {
+	if nocase {
+		return "i" + name
+	}
+	return name
+}
+
+// quote returns s, quoted if needed to be read by ParseExpr.
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"\\()&|!,") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// term formats a term using the syntax read by ParseExpr.
+func term(name string, wholename bool, value string) string {
+	if wholename {
+		name += ".wholename"
+	}
+	return name + ":" + value
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e AllOf) Term() []interface{} {
+	return compound("allof", e)
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e AnyOf) Term() []interface{} {
+	return compound("anyof", e)
+}
+
+func compound(name string, exprs []Expr) []interface{} {
+	term := make([]interface{}, 0, len(exprs)+1)
+	term = append(term, name)
+	for _, e := range exprs {
+		term = append(term, e.Term())
+	}
+	return term
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Not) Term() []interface{} {
+	return []interface{}{"not", e.Expr.Term()}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (True) Term() []interface{} {
+	return []interface{}{"true"}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (False) Term() []interface{} {
+	return []interface{}{"false"}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (Exists) Term() []interface{} {
+	return []interface{}{"exists"}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (Empty) Term() []interface{} {
+	return []interface{}{"empty"}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Match) Term() []interface{} {
+	term := []interface{}{
+		prefix(e.NoCase, "match"), e.Pattern, scope(e.Wholename),
+	}
+	if e.IncludeDotFiles {
+		term = append(term, map[string]interface{}{"includedotfiles": true})
+	}
+	return term
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e PCRE) Term() []interface{} {
+	return []interface{}{
+		prefix(e.NoCase, "pcre"), e.Pattern, scope(e.Wholename),
+	}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Name) Term() []interface{} {
+	return []interface{}{
+		prefix(e.NoCase, "name"), e.Names, scope(e.Wholename),
+	}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e DirName) Term() []interface{} {
+	return []interface{}{prefix(e.NoCase, "dirname"), e.Path}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Suffix) Term() []interface{} {
+	if len(e.Suffixes) == 1 {
+		return []interface{}{"suffix", e.Suffixes[0]}
+	}
+	return []interface{}{"suffix", e.Suffixes}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Type) Term() []interface{} {
+	return []interface{}{"type", e.Type}
+}
+
+// Term returns the expression as used by the Watchman protocol.
+func (e Size) Term() []interface{} {
+	return []interface{}{"size", string(e.Op), e.Value}
+}
+
+func (e AllOf) String() string {
+	if len(e) < 1 {
+		return "true"
+	}
+	return join(e, " && ", func(e Expr) bool {
+		switch e.(type) {
+		case AllOf, AnyOf:
+			return true
+		}
+		return false
+	})
+}
+
+func (e AnyOf) String() string {
+	if len(e) < 1 {
+		return "false"
+	}
+	return join(e, " || ", func(e Expr) bool {
+		_, ok := e.(AnyOf)
+		return ok
+	})
+}
+
+func join(exprs []Expr, op string, parens func(Expr) bool) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		if parens(e) {
+			parts[i] = "(" + e.String() + ")"
+		} else {
+			parts[i] = e.String()
+		}
+	}
+	return strings.Join(parts, op)
+}
+
+func (e Not) String() string {
+	switch e.Expr.(type) {
+	case AllOf, AnyOf:
+		return "!(" + e.Expr.String() + ")"
+	}
+	return "!" + e.Expr.String()
+}
+
+func (True) String() string {
+	return "true"
+}
+
+func (False) String() string {
+	return "false"
+}
+
+func (Exists) String() string {
+	return "exists"
+}
+
+func (Empty) String() string {
+	return "empty"
+}
+
+func (e Match) String() string {
+	name := prefix(e.NoCase, "match")
+	if e.IncludeDotFiles {
+		name += ".dotfiles"
+	}
+	return term(name, e.Wholename, quote(e.Pattern))
+}
+
+func (e PCRE) String() string {
+	return term(prefix(e.NoCase, "pcre"), e.Wholename, quote(e.Pattern))
+}
+
+func (e Name) String() string {
+	names := make([]string, len(e.Names))
+	for i, name := range e.Names {
+		names[i] = quote(name)
+	}
+	return term(prefix(e.NoCase, "name"), e.Wholename, strings.Join(names, ","))
+}
+
+func (e DirName) String() string {
+	return term(prefix(e.NoCase, "dirname"), false, quote(e.Path))
+}
+
+func (e Suffix) String() string {
+	suffixes := make([]string, len(e.Suffixes))
+	for i, suffix := range e.Suffixes {
+		suffixes[i] = quote(suffix)
+	}
+	return term("suffix", false, strings.Join(suffixes, ","))
+}
+
+func (e Type) String() string {
+	return term("type", false, quote(e.Type))
+}
+
+func (e Size) String() string {
+	return term("size", false, sizeOpSymbols[e.Op]+strconv.FormatInt(e.Value, 10))
+}
@@ -0,0 +1,68 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprTerm(t *testing.T) {
+	for _, tc := range []struct {
+		expr     Expr
+		expected []interface{}
+	}{
+		{AllOf{}, []interface{}{"allof"}},
+		{
+			AnyOf{True{}, Not{Expr: False{}}},
+			[]interface{}{"anyof",
+				[]interface{}{"true"},
+				[]interface{}{"not", []interface{}{"false"}},
+			},
+		},
+		{Exists{}, []interface{}{"exists"}},
+		{Empty{}, []interface{}{"empty"}},
+		{
+			Match{Pattern: "*.go"},
+			[]interface{}{"match", "*.go", "basename"},
+		},
+		{
+			Match{Pattern: "src/**", Wholename: true, NoCase: true, IncludeDotFiles: true},
+			[]interface{}{"imatch", "src/**", "wholename",
+				map[string]interface{}{"includedotfiles": true},
+			},
+		},
+		{
+			PCRE{Pattern: "^a", NoCase: true},
+			[]interface{}{"ipcre", "^a", "basename"},
+		},
+		{
+			Name{Names: []string{"go.mod"}, Wholename: true},
+			[]interface{}{"name", []string{"go.mod"}, "wholename"},
+		},
+		{
+			DirName{Path: "vendor", NoCase: true},
+			[]interface{}{"idirname", "vendor"},
+		},
+		{Suffix{Suffixes: []string{"go"}}, []interface{}{"suffix", "go"}},
+		{
+			Suffix{Suffixes: []string{"c", "h"}},
+			[]interface{}{"suffix", []string{"c", "h"}},
+		},
+		{Type{Type: "f"}, []interface{}{"type", "f"}},
+		{Size{Op: Ge, Value: 42}, []interface{}{"size", "ge", int64(42)}},
+	} {
+		require.Equal(t, tc.expected, tc.expr.Term())
+	}
+}
+
+func TestExprString(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("true", AllOf{}.String())
+	require.Equal("false", AnyOf{}.String())
+	require.Equal(`match:"a b" && name:"x,y",z`, AllOf{
+		Match{Pattern: "a b"},
+		Name{Names: []string{"x,y", "z"}},
+	}.String())
+	require.Equal(`pcre:""`, PCRE{}.String())
+}
@@ -0,0 +1,195 @@
+package watchman
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+type fakeHandler func(args []interface{}) protocol.ResponsePDU
+
+// fakeServer answers requests from Clients over net.Pipe connections,
+// so that the high-level API can be tested without a running Watchman
+// server.
+type fakeServer struct {
+	t *testing.T
+	w sync.Mutex // serializes writes
+
+	mu           sync.Mutex
+	capabilities []string
+	conns        []net.Conn
+	handlers     map[string]fakeHandler
+	requests     []fakeRequest
+}
+
+type fakeRequest struct {
+	conn int
+	args []interface{}
+}
+
+func newFakeServer(t *testing.T, capabilities ...string) *fakeServer {
+	return &fakeServer{
+		t:            t,
+		capabilities: capabilities,
+		handlers:     map[string]fakeHandler{},
+	}
+}
+
+// close simulates the server dropping every connection.
+func (s *fakeServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// closeConn simulates the server dropping one connection.
+func (s *fakeServer) closeConn(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[i].Close()
+}
+
+// connect returns a Client that communicates with the fake server.
+func (s *fakeServer) connect(opts ...Option) *Client {
+	s.t.Helper()
+
+	c, err := Connect(append(s.options(), opts...)...)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return c
+}
+
+// dial implements protocol.Dialer by starting a new connection.
+func (s *fakeServer) dial(sockname string, timeout time.Duration) (net.Conn, error) {
+	client, server := net.Pipe()
+	s.mu.Lock()
+	s.conns = append(s.conns, server)
+	i := len(s.conns) - 1
+	s.mu.Unlock()
+	go s.serve(i, server)
+	return client, nil
+}
+
+// options returns the Options needed to connect to the fake server.
+func (s *fakeServer) options() []Option {
+	return []Option{
+		WithDialer(s.dial),
+		WithSockName("fake"),
+	}
+}
+
+// handle registers a handler for a Watchman command.
+func (s *fakeServer) handle(command string, h fakeHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = h
+}
+
+// history returns the requests received so far by every connection.
+func (s *fakeServer) history() [][]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([][]interface{}, len(s.requests))
+	for i, req := range s.requests {
+		result[i] = req.args
+	}
+	return result
+}
+
+// last returns the arguments of the most recent request for a command,
+// so that handlers do not need to make assertions outside of the test
+// goroutine.
+func (s *fakeServer) last(command string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if s.requests[i].args[0] == command {
+			return s.requests[i].args
+		}
+	}
+	return nil
+}
+
+// historyOf returns the commands received so far by one connection.
+func (s *fakeServer) historyOf(conn int) (commands []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.requests {
+		if req.conn == conn {
+			commands = append(commands, req.args[0].(string))
+		}
+	}
+	return
+}
+
+// send writes a PDU, for example a unilateral notification, to the
+// first connection.
+func (s *fakeServer) send(pdu protocol.ResponsePDU) {
+	s.sendTo(0, pdu)
+}
+
+// sendTo writes a PDU to a specific connection.
+func (s *fakeServer) sendTo(i int, pdu protocol.ResponsePDU) {
+	s.mu.Lock()
+	conn := s.conns[i]
+	s.mu.Unlock()
+
+	s.w.Lock()
+	defer s.w.Unlock()
+	b, err := json.Marshal(pdu)
+	if err == nil {
+		_, err = conn.Write(append(b, '\n'))
+	}
+	if err != nil {
+		s.t.Log(err)
+	}
+}
+
+func (s *fakeServer) serve(i int, conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var args []interface{}
+		if err := json.Unmarshal(line, &args); err != nil || len(args) < 1 {
+			s.sendTo(i, protocol.ResponsePDU{"error": "invalid request"})
+			continue
+		}
+
+		command, _ := args[0].(string)
+		s.mu.Lock()
+		s.requests = append(s.requests, fakeRequest{conn: i, args: args})
+		h, ok := s.handlers[command]
+		s.mu.Unlock()
+
+		var pdu protocol.ResponsePDU
+		switch {
+		case ok:
+			pdu = h(args)
+		case command == "list-capabilities":
+			pdu = protocol.ResponsePDU{"capabilities": s.capabilities}
+		default:
+			pdu = protocol.ResponsePDU{
+				"error": "unknown command " + command,
+			}
+		}
+		if pdu == nil {
+			continue
+		}
+		if _, ok := pdu["version"]; !ok {
+			pdu["version"] = "4.9.0"
+		}
+		s.sendTo(i, pdu)
+	}
+}
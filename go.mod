@@ -1,6 +1,6 @@
 module github.com/sjansen/watchman
 
-go 1.17
+go 1.21
 
 require (
 	github.com/Microsoft/go-winio v0.5.2
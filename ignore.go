@@ -0,0 +1,265 @@
+package watchman
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ignoreFiles lists the names of ignore files, from lowest to highest
+// precedence within a directory.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// An IgnoreFilter removes files matched by .gitignore and .ignore files
+// from ChangeNotifications. Ignore files are read from every directory
+// within a tree, using the same rules as git, including negation with
+// "!". Rules are updated when notifications include changes to ignore
+// files.
+//
+// Ignore files outside of the tree, such as in a parent directory, are
+// not read.
+//
+// An IgnoreFilter is safe for concurrent use by multiple goroutines.
+type IgnoreFilter struct {
+	dir string
+
+	mu    sync.Mutex
+	rules map[string][]ignoreRule // by ignore file name
+	// files lists the ignore files with rules, from lowest to highest
+	// precedence
+	files []string
+}
+
+type ignoreRule struct {
+	pattern  string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// NewIgnoreFilter reads the ignore files within dir. File names passed
+// to the IgnoreFilter must be relative to dir, such as the names in
+// notifications for a Watch of dir.
+func NewIgnoreFilter(dir string) (*IgnoreFilter, error) {
+	f := &IgnoreFilter{
+		dir:   dir,
+		rules: map[string][]ignoreRule{},
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if name == "." {
+			name = ""
+		} else if d.Name() == ".git" || f.Match(name, true) {
+			return filepath.SkipDir
+		}
+
+		for _, base := range ignoreFiles {
+			if err := f.load(path.Join(name, base)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// load reads an ignore file, forgetting its rules if it does not exist.
+func (f *IgnoreFilter) load(name string) error {
+	b, err := os.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		f.setRules(name, nil)
+		return err
+	}
+
+	f.setRules(name, parseIgnoreFile(string(b)))
+	return nil
+}
+
+// setRules replaces the rules of an ignore file, keeping files sorted.
+func (f *IgnoreFilter) setRules(name string, rules []ignoreRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.rules[name]
+	i := sort.Search(len(f.files), func(i int) bool {
+		return !lowerPrecedence(f.files[i], name)
+	})
+	for i < len(f.files) && exists && f.files[i] != name {
+		i++
+	}
+	switch {
+	case len(rules) > 0 && !exists:
+		f.files = append(f.files, "")
+		copy(f.files[i+1:], f.files[i:])
+		f.files[i] = name
+	case len(rules) < 1 && exists:
+		f.files = append(f.files[:i], f.files[i+1:]...)
+	}
+	if len(rules) > 0 {
+		f.rules[name] = rules
+	} else {
+		delete(f.rules, name)
+	}
+}
+
+// lowerPrecedence reports whether the rules of ignore file a are
+// overridden by those of b, if both apply to the same file. Every
+// directory containing an applicable ignore file is a parent of the
+// file, so shorter is shallower.
+func lowerPrecedence(a, b string) bool {
+	depth := func(file string) int {
+		if dir := path.Dir(file); dir != "." {
+			return len(dir) + 1
+		}
+		return 0
+	}
+	if da, db := depth(a), depth(b); da != db {
+		return da < db
+	}
+	return precedence(path.Base(a)) < precedence(path.Base(b))
+}
+
+func parseIgnoreFile(content string) (rules []ignoreRule) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		// trailing spaces are ignored unless escaped
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		r := ignoreRule{}
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.pattern = line
+		rules = append(rules, r)
+	}
+	return
+}
+
+// Match reports whether a file or directory is ignored. A file is
+// ignored if any of its parent directories are ignored.
+func (f *IgnoreFilter) Match(name string, isDir bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && f.match(name[:i], true) {
+			return true
+		}
+	}
+	return f.match(name, isDir)
+}
+
+// match checks the rules of ignore files in the parent directories of
+// name, ordered so that the last matching rule has highest precedence.
+func (f *IgnoreFilter) match(name string, isDir bool) bool {
+	ignored := false
+	for _, file := range f.files {
+		rel := name
+		if dir := path.Dir(file); dir != "." {
+			if !strings.HasPrefix(name, dir+"/") {
+				continue
+			}
+			rel = name[len(dir)+1:]
+		}
+		for _, r := range f.rules[file] {
+			if r.matches(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func precedence(base string) int {
+	for i, x := range ignoreFiles {
+		if x == base {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *ignoreRule) matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		name = path.Base(name)
+	}
+	return wildmatch(r.pattern, name, true, false, false)
+}
+
+// Filter returns a copy of cn without ignored Files. Changes to ignore
+// files are applied before filtering. Filter returns nil if every file
+// was removed from a notification that is not a fresh instance.
+//
+// Filter reads any changed ignore files, so it may block.
+func (f *IgnoreFilter) Filter(cn *ChangeNotification) *ChangeNotification {
+	for _, file := range cn.Files {
+		if precedence(path.Base(file.Name)) >= 0 {
+			// unreadable ignore files are treated as removed
+			_ = f.load(file.Name)
+		}
+	}
+
+	filtered := *cn
+	filtered.Files = make([]File, 0, len(cn.Files))
+	for _, file := range cn.Files {
+		if !f.Match(file.Name, file.Type == "d") {
+			filtered.Files = append(filtered.Files, file)
+		}
+	}
+	if len(filtered.Files) < 1 && len(cn.Files) > 0 && !cn.IsFreshInstance {
+		return nil
+	}
+	return &filtered
+}
+
+// WithIgnoreFilter removes files matched by f from the notifications of
+// a subscription. Notifications are filtered as they are delivered, not
+// as they are received, so that reading ignore files does not delay
+// other subscriptions or responses. Notifications in which every file
+// is ignored still use space in the subscription's buffer.
+func WithIgnoreFilter(f *IgnoreFilter) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.ignore = f
+	}
+}
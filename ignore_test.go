@@ -0,0 +1,113 @@
+package watchman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+	}
+}
+
+func TestIgnoreFilter(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore": "# comment\n" +
+			"build/\n" +
+			"*.log\n" +
+			"!keep.log\n" +
+			"node_modules\n" +
+			"/secret.txt   \n" +
+			"docs/**/*.html\n",
+		"sub/.gitignore":        "*.tmp\n!debug.log\n",
+		"sub/.ignore":           "local/\n",
+		"build/.gitignore":      "!output.o\n",
+		"build/output.o":        "",
+		"sub/build/output.o":    "",
+		"sub/local/x.go":        "",
+		"node_modules/x/x.js":   "",
+		"sub/node_modules/x.js": "",
+	})
+
+	f, err := NewIgnoreFilter(dir)
+	require.NoError(err)
+	require.Equal([]string{".gitignore", "sub/.gitignore", "sub/.ignore"}, f.files)
+
+	for _, tc := range []struct {
+		name     string
+		isDir    bool
+		expected bool
+	}{
+		{"main.go", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/output.o", false, true},
+		{"sub/build/output.o", false, true},
+		{"error.log", false, true},
+		{"keep.log", false, false},
+		{"sub/error.log", false, true},
+		{"sub/debug.log", false, false},
+		{"debug.log", false, true},
+		{"sub/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"sub/local/x.go", false, true},
+		{"local/x.go", false, false},
+		{"node_modules/x/x.js", false, true},
+		{"sub/node_modules/x.js", false, true},
+		{"secret.txt", false, true},
+		{"sub/secret.txt", false, false},
+		{"docs/a/b/index.html", false, true},
+		{"docs/index.html", false, true},
+		{"sub/docs/index.html", false, false},
+	} {
+		require.Equal(tc.expected, f.Match(tc.name, tc.isDir), tc.name)
+	}
+
+	// rules are updated when ignore files change
+	writeFiles(t, dir, map[string]string{
+		".gitignore": "*.md\n",
+	})
+	require.NoError(os.Remove(filepath.Join(dir, "sub", ".ignore")))
+	cn := f.Filter(&ChangeNotification{
+		Clock: "c:1531594843:978:9:2",
+		Files: []File{
+			{Change: Updated, Name: ".gitignore", Type: "f"},
+			{Change: Removed, Name: "sub/.ignore", Type: "f"},
+			{Change: Created, Name: "README.md", Type: "f"},
+			{Change: Created, Name: "error.log", Type: "f"},
+			{Change: Created, Name: "sub/local/x.go", Type: "f"},
+		},
+	})
+	require.Equal(&ChangeNotification{
+		Clock: "c:1531594843:978:9:2",
+		Files: []File{
+			{Change: Updated, Name: ".gitignore", Type: "f"},
+			{Change: Removed, Name: "sub/.ignore", Type: "f"},
+			{Change: Created, Name: "error.log", Type: "f"},
+			{Change: Created, Name: "sub/local/x.go", Type: "f"},
+		},
+	}, cn)
+	require.Equal([]string{".gitignore", "sub/.gitignore"}, f.files)
+
+	// notifications are dropped if every file is ignored
+	filter := newSubscribeOptions([]SubscribeOption{
+		WithIgnoreFilter(f),
+	}).deliveryFilter()
+	require.Nil(filter(&ChangeNotification{
+		Files: []File{{Change: Created, Name: "README.md", Type: "f"}},
+	}))
+	require.NotNil(filter(&ChangeNotification{
+		IsFreshInstance: true,
+		Files:           []File{{Change: Created, Name: "README.md", Type: "f"}},
+	}))
+}
@@ -4,12 +4,14 @@
 package watchman_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -18,12 +20,14 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/sjansen/watchman"
+	"github.com/sjansen/watchman/protocol"
+	"github.com/sjansen/watchman/server"
 )
 
 const pause = 250 * time.Millisecond
 
-func collect(updates <-chan interface{}) []interface{} {
-	messages := make([]interface{}, 0, 3)
+func collect(updates <-chan watchman.Event) []watchman.Event {
+	messages := make([]watchman.Event, 0, 3)
 	var wg sync.WaitGroup
 
 	wg.Add(1)
@@ -123,21 +127,62 @@ func TestClient(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	// connect
-	c, err := watchman.Connect()
+	srv, err := server.Start()
 	require.NoError(err)
+	c := srv.Client()
 
 	// connection metadata
 	require.NotEmpty(c.SockName())
 	require.NotEmpty(c.Version())
 
+	// get-pid
+	pid, err := c.PID()
+	require.NoError(err)
+	require.NotZero(pid)
+
+	// log-level & log
+	logs, err := c.SubscribeLogs(watchman.LogDebug)
+	require.NoError(err)
+
+	logged := make(chan struct{})
+	go func() {
+		var once sync.Once
+		for entry := range logs {
+			if strings.Contains(entry.Message, "Kilroy was here.") {
+				once.Do(func() { close(logged) })
+			}
+		}
+	}()
+
+	err = c.Log(watchman.LogError, "Kilroy was here.")
+	require.NoError(err)
+	select {
+	case <-logged:
+	case <-time.After(pause):
+		require.Fail("log message not received")
+	}
+
+	_, err = c.SubscribeLogs(watchman.LogOff)
+	require.NoError(err)
+
 	// capabilities
 	require.Equal(true, c.HasCapability("cmd-subscribe"))
 	require.Equal(false, c.HasCapability("grant-three-wishes"))
 
+	// raw command
+	pdu, err := c.Do(context.Background(), protocol.RawRequest{"version"})
+	require.NoError(err)
+	require.Equal(c.Version(), pdu["version"])
+
 	// watch-project
 	watch, err := c.AddWatch(dir)
 	require.NoError(err)
 
+	// get-config
+	cfg, err := watch.Config()
+	require.NoError(err)
+	require.Equal(5*time.Minute, cfg.IdleReapAge)
+
 	updates := c.Notifications()
 	n := len(collect(updates))
 	require.Equal(0, n)
@@ -148,7 +193,7 @@ func TestClient(t *testing.T) {
 	require.NotEmpty(roots)
 
 	// subscribe
-	s, err := watch.Subscribe("Spoon!", dir)
+	s, err := watch.SubscribeChanges("Spoon!")
 	require.NoError(err)
 
 	n = len(collect(updates))
@@ -173,6 +218,16 @@ func TestClient(t *testing.T) {
 	require.NotEmpty(clock2)
 	require.NotEqual(clock1, clock2)
 
+	// query
+	result, err := watch.Query(&watchman.Query{Since: clock1})
+	require.NoError(err)
+	require.NotEmpty(result.Clock)
+	names := make([]string, 0, len(result.Files))
+	for _, file := range result.Files {
+		names = append(names, file.Name)
+	}
+	require.Subset(names, []string{"foo", "bar", "baz"})
+
 	// state changes
 	err = touch(dir, "baz", "qux", "quux")
 	require.NoError(err)
@@ -238,7 +293,7 @@ func TestClient(t *testing.T) {
 	err = s.Unsubscribe()
 	require.NoError(err)
 
-	// close
-	err = c.Close()
+	// shutdown
+	err = srv.Close()
 	require.NoError(err)
 }
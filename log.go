@@ -0,0 +1,80 @@
+package watchman
+
+import (
+	"strings"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// A LogLevel controls which server log messages are sent to a Client.
+type LogLevel string
+
+const (
+	// LogOff - no log messages
+	LogOff LogLevel = "off"
+	// LogError - only error messages
+	LogError LogLevel = "error"
+	// LogDebug - all messages, including errors
+	LogDebug LogLevel = "debug"
+)
+
+// A LogEntry represents a message from the Watchman server log.
+type LogEntry struct {
+	Level   LogLevel
+	Message string
+}
+
+// queuedLog wraps a LogEntry so that it can be buffered by a queue. It
+// is never delivered as an Event.
+type queuedLog struct {
+	LogEntry
+}
+
+func (queuedLog) event() {}
+
+func newLogEntry(l *protocol.Log) LogEntry {
+	return LogEntry{
+		Level:   LogLevel(l.Level()),
+		Message: strings.TrimSuffix(l.Log(), "\n"),
+	}
+}
+
+// Log writes a message to the Watchman server log.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/log.html
+func (c *Client) Log(level LogLevel, msg string) error {
+	req := &protocol.LogRequest{
+		Level:   string(level),
+		Message: msg,
+	}
+	_, err := c.send(req)
+	return err
+}
+
+// logBufferSize is how many log messages are buffered for a Client.
+const logBufferSize = 256
+
+// SubscribeLogs requests that messages from the Watchman server log at
+// or above level be sent to the Client, and returns the channel they
+// are delivered on. Use LogOff to stop receiving messages.
+//
+// Messages are buffered, so a slow reader never delays responses to
+// requests. If the buffer is full, the oldest message is discarded, and
+// counted by DroppedLogs.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/log-level.html
+func (c *Client) SubscribeLogs(level LogLevel) (<-chan LogEntry, error) {
+	req := &protocol.LogLevelRequest{Level: string(level)}
+	if _, err := c.send(req); err != nil {
+		return nil, err
+	}
+	return c.loop.logs, nil
+}
+
+// DroppedLogs returns the number of server log messages discarded
+// because they were not read from the channel returned by SubscribeLogs
+// quickly enough.
+func (c *Client) DroppedLogs() uint64 {
+	_, dropped := c.loop.logQueue.stats()
+	return dropped
+}
@@ -0,0 +1,85 @@
+package watchman
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestLogs(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("log", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"logged": true}
+	})
+	s.handle("log-level", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"log_level": args[1]}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	logs, err := c.SubscribeLogs(LogDebug)
+	require.NoError(err)
+
+	err = c.Log(LogError, "Kilroy was here.")
+	require.NoError(err)
+	require.Equal(
+		[]interface{}{"log", "error", "Kilroy was here."},
+		s.history()[2],
+	)
+
+	s.send(protocol.ResponsePDU{
+		"unilateral": true,
+		"level":      "error",
+		"log":        "1531594843: Kilroy was here.\n",
+	})
+	require.Equal(LogEntry{
+		Level:   LogError,
+		Message: "1531594843: Kilroy was here.",
+	}, <-logs)
+
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock":        "c:1531594843:978:9:826",
+		"files":        []interface{}{},
+	})
+	require.IsType(&ChangeNotification{}, <-c.Notifications())
+}
+
+func TestLogsDoNotBlockResponses(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("log-level", func(args []interface{}) protocol.ResponsePDU {
+		// the server may send log messages before its response
+		for i := 0; i < logBufferSize+10; i++ {
+			s.send(protocol.ResponsePDU{
+				"unilateral": true,
+				"level":      "debug",
+				"log":        fmt.Sprintf("message %d\n", i),
+			})
+		}
+		return protocol.ResponsePDU{"log_level": args[1]}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	logs, err := c.SubscribeLogs(LogDebug)
+	require.NoError(err)
+
+	// one message may already be waiting to be read from logs
+	dropped := int(c.DroppedLogs())
+	require.InDelta(10, dropped, 1)
+	var last LogEntry
+	for i := dropped; i < logBufferSize+10; i++ {
+		last = <-logs
+	}
+	require.Equal(fmt.Sprintf("message %d", logBufferSize+9), last.Message)
+}
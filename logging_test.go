@@ -0,0 +1,44 @@
+package watchman
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestLogHandler(t *testing.T) {
+	require := require.New(t)
+
+	logged := &bytes.Buffer{}
+	handler := slog.NewTextHandler(logged, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	})
+
+	s := newFakeServer(t)
+	c := s.connect(WithLogHandler(handler))
+
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "unknown",
+		"clock":        "c:1531594843:978:9:2",
+		"files":        []interface{}{},
+	})
+	<-c.Notifications()
+	s.close()
+	for range c.Notifications() {
+	}
+	c.Close()
+	c.Close()
+
+	output := logged.String()
+	require.Contains(output, `msg=connected sockname=fake version=4.9.0`)
+	require.Contains(output, `msg="sending PDU"`)
+	require.Contains(output, `msg="routing unilateral PDU" destination=notifications`)
+	require.Contains(output, `level=INFO msg="connection closed by server"`)
+	require.Equal(1, strings.Count(output, `msg=disconnecting`))
+}
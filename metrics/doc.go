@@ -0,0 +1,9 @@
+// Package metrics implements a watchman.Observer that collects metrics
+// about requests and subscriptions, and serves them over HTTP using the
+// Prometheus text exposition format.
+//
+//	collector := metrics.NewCollector()
+//	client, err := watchman.Connect(watchman.WithObserver(collector))
+//	...
+//	http.Handle("/metrics", collector)
+package metrics
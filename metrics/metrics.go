@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sjansen/watchman"
+)
+
+// A Collector is a watchman.Observer that records metrics, and an
+// http.Handler that serves them.
+//
+// A Collector is safe for concurrent use by multiple goroutines, and
+// can observe many Clients.
+type Collector struct {
+	mu            sync.Mutex
+	inFlight      int
+	reconnects    uint64
+	requests      map[string]*requestMetrics
+	subscriptions map[string]*subscriptionMetrics
+}
+
+type requestMetrics struct {
+	ok       uint64
+	failed   uint64
+	seconds  float64
+	sent     uint64
+	received uint64
+}
+
+type subscriptionMetrics struct {
+	delivered  uint64
+	lagSeconds float64
+	depth      int
+	dropped    uint64
+	// total is the last total reported by NotificationsDropped, which
+	// restarts from zero if the subscription is replaced
+	total uint64
+}
+
+var _ watchman.Observer = &Collector{}
+
+// NewCollector returns a Collector with no recorded metrics.
+func NewCollector() *Collector {
+	return &Collector{
+		requests:      map[string]*requestMetrics{},
+		subscriptions: map[string]*subscriptionMetrics{},
+	}
+}
+
+func (c *Collector) request(command string) *requestMetrics {
+	m, ok := c.requests[command]
+	if !ok {
+		m = &requestMetrics{}
+		c.requests[command] = m
+	}
+	return m
+}
+
+func (c *Collector) subscription(name string) *subscriptionMetrics {
+	m, ok := c.subscriptions[name]
+	if !ok {
+		m = &subscriptionMetrics{}
+		c.subscriptions[name] = m
+	}
+	return m
+}
+
+// RequestStarted implements watchman.Observer.
+func (c *Collector) RequestStarted(command string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight++
+}
+
+// RequestFinished implements watchman.Observer.
+func (c *Collector) RequestFinished(stats *watchman.RequestStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	m := c.request(stats.Command)
+	if stats.Err != nil {
+		m.failed++
+	} else {
+		m.ok++
+	}
+	m.seconds += stats.Latency.Seconds()
+	m.sent += uint64(stats.Sent)
+	m.received += uint64(stats.Received)
+}
+
+// NotificationDelivered implements watchman.Observer.
+func (c *Collector) NotificationDelivered(subscription string, lag time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.subscription(subscription)
+	m.delivered++
+	m.lagSeconds += lag.Seconds()
+}
+
+// NotificationsDropped implements watchman.Observer.
+func (c *Collector) NotificationsDropped(subscription string, total uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.subscription(subscription)
+	if total > m.total {
+		m.dropped += total - m.total
+	} else {
+		m.dropped += total
+	}
+	m.total = total
+}
+
+// QueueDepth implements watchman.Observer.
+func (c *Collector) QueueDepth(subscription string, depth int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscription(subscription).depth = depth
+}
+
+// Reconnected implements watchman.Observer.
+func (c *Collector) Reconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnects++
+}
+
+// ServeHTTP writes every metric using the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteTo(w)
+}
+
+// WriteTo writes every metric to w using the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	b := &strings.Builder{}
+
+	commands := sortedKeys(c.requests)
+	header(b, "watchman_requests_total", "counter",
+		"Requests sent to the Watchman server.")
+	for _, command := range commands {
+		m := c.requests[command]
+		sample(b, "watchman_requests_total", m.ok,
+			"command", command, "result", "ok")
+		sample(b, "watchman_requests_total", m.failed,
+			"command", command, "result", "error")
+	}
+	header(b, "watchman_request_duration_seconds", "summary",
+		"Time until a response was received.")
+	for _, command := range commands {
+		m := c.requests[command]
+		sample(b, "watchman_request_duration_seconds_sum", m.seconds,
+			"command", command)
+		sample(b, "watchman_request_duration_seconds_count", m.ok+m.failed,
+			"command", command)
+	}
+	header(b, "watchman_request_bytes_total", "counter",
+		"Size of encoded requests and responses.")
+	for _, command := range commands {
+		m := c.requests[command]
+		sample(b, "watchman_request_bytes_total", m.sent,
+			"command", command, "direction", "sent")
+		sample(b, "watchman_request_bytes_total", m.received,
+			"command", command, "direction", "received")
+	}
+	header(b, "watchman_requests_in_flight", "gauge",
+		"Requests awaiting a response.")
+	sample(b, "watchman_requests_in_flight", c.inFlight)
+
+	subscriptions := sortedKeys(c.subscriptions)
+	header(b, "watchman_notification_lag_seconds", "summary",
+		"Time from the most recent change in a notification until delivery.")
+	for _, name := range subscriptions {
+		m := c.subscriptions[name]
+		sample(b, "watchman_notification_lag_seconds_sum", m.lagSeconds,
+			"subscription", name)
+		sample(b, "watchman_notification_lag_seconds_count", m.delivered,
+			"subscription", name)
+	}
+	header(b, "watchman_subscription_queue_depth", "gauge",
+		"Notifications buffered for a subscription.")
+	for _, name := range subscriptions {
+		sample(b, "watchman_subscription_queue_depth", c.subscriptions[name].depth,
+			"subscription", name)
+	}
+	header(b, "watchman_notifications_dropped_total", "counter",
+		"Notifications dropped by the overflow policy of a subscription.")
+	for _, name := range subscriptions {
+		sample(b, "watchman_notifications_dropped_total", c.subscriptions[name].dropped,
+			"subscription", name)
+	}
+	header(b, "watchman_reconnects_total", "counter",
+		"Pool members replaced after losing their connection.")
+	sample(b, "watchman_reconnects_total", c.reconnects)
+	c.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a value with labels, given as name/value pairs.
+func sample(b *strings.Builder, name string, value interface{}, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escape(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	switch v := value.(type) {
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		fmt.Fprint(b, v)
+	}
+	b.WriteByte('\n')
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman"
+)
+
+func TestCollector(t *testing.T) {
+	require := require.New(t)
+
+	c := NewCollector()
+	c.RequestStarted("query")
+	c.RequestFinished(&watchman.RequestStats{
+		Command:  "query",
+		Latency:  250 * time.Millisecond,
+		Sent:     100,
+		Received: 2000,
+	})
+	c.RequestStarted("query")
+	c.RequestFinished(&watchman.RequestStats{
+		Command: "query",
+		Latency: 250 * time.Millisecond,
+		Sent:    100,
+		Err:     errors.New("unable to resolve root"),
+	})
+	c.RequestStarted("clock")
+	c.QueueDepth(`sub"1`, 3)
+	c.NotificationDelivered(`sub"1`, 500*time.Millisecond)
+	c.QueueDepth(`sub"1`, 2)
+	c.NotificationsDropped(`sub"1`, 2)
+	c.NotificationsDropped(`sub"1`, 5)
+	// the subscription was replaced
+	c.NotificationsDropped(`sub"1`, 1)
+	c.Reconnected()
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal("text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	require.Equal(`# HELP watchman_requests_total Requests sent to the Watchman server.
+# TYPE watchman_requests_total counter
+watchman_requests_total{command="query",result="ok"} 1
+watchman_requests_total{command="query",result="error"} 1
+# HELP watchman_request_duration_seconds Time until a response was received.
+# TYPE watchman_request_duration_seconds summary
+watchman_request_duration_seconds_sum{command="query"} 0.5
+watchman_request_duration_seconds_count{command="query"} 2
+# HELP watchman_request_bytes_total Size of encoded requests and responses.
+# TYPE watchman_request_bytes_total counter
+watchman_request_bytes_total{command="query",direction="sent"} 200
+watchman_request_bytes_total{command="query",direction="received"} 2000
+# HELP watchman_requests_in_flight Requests awaiting a response.
+# TYPE watchman_requests_in_flight gauge
+watchman_requests_in_flight 1
+# HELP watchman_notification_lag_seconds Time from the most recent change in a notification until delivery.
+# TYPE watchman_notification_lag_seconds summary
+watchman_notification_lag_seconds_sum{subscription="sub\"1"} 0.5
+watchman_notification_lag_seconds_count{subscription="sub\"1"} 1
+# HELP watchman_subscription_queue_depth Notifications buffered for a subscription.
+# TYPE watchman_subscription_queue_depth gauge
+watchman_subscription_queue_depth{subscription="sub\"1"} 2
+# HELP watchman_notifications_dropped_total Notifications dropped by the overflow policy of a subscription.
+# TYPE watchman_notifications_dropped_total counter
+watchman_notifications_dropped_total{subscription="sub\"1"} 6
+# HELP watchman_reconnects_total Pool members replaced after losing their connection.
+# TYPE watchman_reconnects_total counter
+watchman_reconnects_total 1
+`, w.Body.String())
+}
@@ -0,0 +1,270 @@
+package watchman
+
+import "sync"
+
+// A Multiplexer shares one Watchman subscription between many local
+// subscribers. Each Subscriber registers an expression, and receives
+// notifications including only the matching Files.
+//
+// The expression of the Watchman subscription is the union of every
+// Subscriber's expression. When subscribers are added or removed, the
+// subscription is replaced using the clock of the latest notification,
+// so that no changes are missed.
+//
+// Notifications are delivered to one Subscriber at a time, so a
+// Subscriber that stops receiving delays every other Subscriber, and
+// eventually the Watchman subscription as its queue policy allows.
+// Delivery does not block Subscribe, Close, or Subscriber.Close.
+type Multiplexer struct {
+	watch *Watch
+	name  string
+	opts  []SubscribeOption
+	query Query
+
+	// resubscribe serializes changes to the Watchman subscription
+	resubscribe sync.Mutex
+	sub         *Subscription
+
+	mu          sync.Mutex
+	clock       string
+	subscribers []*Subscriber
+}
+
+// A Subscriber receives the notifications of a Multiplexer that match
+// its expression.
+type Subscriber struct {
+	expr Expr
+	mux  *Multiplexer
+	ch   chan Event
+	done chan struct{}
+	once sync.Once
+
+	// mu is held while sending on ch, so that it can be closed safely
+	mu     sync.Mutex
+	closed bool
+}
+
+// withHandler delivers notifications to h instead of Notifications.
+func withHandler(h func(e Event, quit <-chan struct{})) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.handler = h
+	}
+}
+
+// withStopped calls f if the subscription ends because the connection
+// to the Watchman server was closed or lost.
+func withStopped(f func()) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.stopped = f
+	}
+}
+
+// Multiplex returns a Multiplexer for a watched root. The Watchman
+// subscription is created by the first call to Subscribe, using name
+// and opts. If opts include WithQuery, its Expression is combined with
+// the expression of every Subscriber.
+func (w *Watch) Multiplex(name string, opts ...SubscribeOption) *Multiplexer {
+	m := &Multiplexer{
+		watch: w,
+		name:  name,
+		opts:  opts,
+	}
+	if o := newSubscribeOptions(opts); o.query != nil {
+		m.query = *o.query
+	}
+	return m
+}
+
+// Subscribe registers a Subscriber for files matching e.
+func (m *Multiplexer) Subscribe(e Expr) (*Subscriber, error) {
+	s := &Subscriber{
+		expr: e,
+		mux:  m,
+		ch:   make(chan Event),
+		done: make(chan struct{}),
+	}
+
+	m.resubscribe.Lock()
+	defer m.resubscribe.Unlock()
+
+	m.mu.Lock()
+	m.subscribers = append(m.subscribers, s)
+	m.mu.Unlock()
+
+	if err := m.update(); err != nil {
+		s.once.Do(func() { close(s.done) })
+		m.remove(s)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close removes every Subscriber, and cancels the Watchman subscription.
+func (m *Multiplexer) Close() error {
+	m.resubscribe.Lock()
+	defer m.resubscribe.Unlock()
+
+	m.mu.Lock()
+	subscribers := m.subscribers
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.once.Do(func() { close(s.done) })
+		m.remove(s)
+	}
+	return m.update()
+}
+
+// remove unregisters s, returning false if it was already removed.
+func (m *Multiplexer) remove(s *Subscriber) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, x := range m.subscribers {
+		if x == s {
+			m.subscribers = append(m.subscribers[:i], m.subscribers[i+1:]...)
+			s.close()
+			return true
+		}
+	}
+	return false
+}
+
+// update replaces the Watchman subscription to match the current set
+// of subscribers. The caller must hold resubscribe.
+func (m *Multiplexer) update() error {
+	m.mu.Lock()
+	union := make(AnyOf, len(m.subscribers))
+	for i, s := range m.subscribers {
+		union[i] = s.expr
+	}
+	clock := m.clock
+	m.mu.Unlock()
+
+	if len(union) < 1 {
+		if m.sub == nil {
+			return nil
+		}
+		err := m.sub.Unsubscribe()
+		m.sub = nil
+		return err
+	}
+
+	q := m.query
+	var e Expr = union
+	if len(union) == 1 {
+		e = union[0]
+	}
+	if q.Expression != nil {
+		e = AllOf{q.Expression, e}
+	}
+	q.Expression = e
+	if clock != "" {
+		q.Since = clock
+	}
+
+	opts := append(m.opts[:len(m.opts):len(m.opts)],
+		WithQuery(&q),
+		withHandler(m.dispatch),
+		withStopped(m.disconnected),
+	)
+	sub, err := m.watch.SubscribeChanges(m.name, opts...)
+	if err != nil {
+		return err
+	}
+	m.sub = sub
+	return nil
+}
+
+// disconnected closes every Subscriber when the connection used by the
+// Watchman subscription is closed or lost.
+func (m *Multiplexer) disconnected() {
+	m.mu.Lock()
+	subscribers := m.subscribers
+	m.subscribers = nil
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.once.Do(func() { close(s.done) })
+		s.close()
+	}
+}
+
+// dispatch delivers a notification to every matching Subscriber. The
+// Multiplexer's lock is released before sending, so that a slow
+// Subscriber cannot block Subscribe or Close.
+func (m *Multiplexer) dispatch(item Event, quit <-chan struct{}) {
+	m.mu.Lock()
+	cn, ok := item.(*ChangeNotification)
+	if ok {
+		m.clock = cn.Clock
+	}
+	subscribers := append([]*Subscriber(nil), m.subscribers...)
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+		x := item
+		if ok {
+			filtered := cn.Filter(s.expr)
+			if len(filtered.Files) < 1 && !cn.IsFreshInstance {
+				continue
+			}
+			x = filtered
+		}
+		if !s.send(x, quit) {
+			return
+		}
+	}
+}
+
+// send delivers an Event unless the Subscriber is closed, returning
+// false if quit is closed first.
+func (s *Subscriber) send(e Event, quit <-chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- e:
+	case <-s.done:
+	case <-quit:
+		return false
+	}
+	return true
+}
+
+// close closes ch. The caller must close done first, so that a pending
+// send returns.
+func (s *Subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	close(s.ch)
+}
+
+// Close unregisters the Subscriber, and closes its Notifications channel.
+// The Watchman subscription is cancelled if no subscribers remain.
+func (s *Subscriber) Close() error {
+	s.once.Do(func() { close(s.done) })
+
+	m := s.mux
+	m.resubscribe.Lock()
+	defer m.resubscribe.Unlock()
+
+	if !m.remove(s) {
+		return nil
+	}
+	return m.update()
+}
+
+// Notifications returns a channel that emits ChangeNotifications
+// including only the Files matching the Subscriber's expression, and
+// other Events for the Watchman subscription. The channel is closed by
+// Close, by closing the Multiplexer, or if the connection to the
+// Watchman server is closed or lost.
+func (s *Subscriber) Notifications() <-chan Event {
+	return s.ch
+}
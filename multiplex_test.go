@@ -0,0 +1,191 @@
+package watchman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestMultiplexer(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "term-allof", "term-anyof", "term-type", "term-suffix")
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("unsubscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"unsubscribe": args[2],
+			"deleted":     true,
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	file := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name, "type": "f", "size": 42, "exists": true,
+			"cclock": "c:1531594843:978:9:1",
+		}
+	}
+	notify := func(clock string, fresh bool) {
+		s.send(protocol.ResponsePDU{
+			"unilateral":        true,
+			"subscription":      "mux",
+			"clock":             clock,
+			"is_fresh_instance": fresh,
+			"files": []interface{}{
+				file("main.go"), file("README.md"),
+			},
+		})
+	}
+	names := func(x interface{}) (names []string) {
+		for _, f := range x.(*ChangeNotification).Files {
+			names = append(names, f.Name)
+		}
+		return
+	}
+
+	w := &Watch{client: c, root: "/tmp"}
+	m := w.Multiplex("mux", WithQuery(&Query{
+		Expression: Type{Type: "f"},
+	}))
+
+	a, err := m.Subscribe(Suffix{Suffixes: []string{"go"}})
+	require.NoError(err)
+	notify("c:1531594843:978:9:2", true)
+	require.Equal([]string{"main.go"}, names(<-a.Notifications()))
+
+	b, err := m.Subscribe(Suffix{Suffixes: []string{"md"}})
+	require.NoError(err)
+	notify("c:1531594843:978:9:3", false)
+	require.Equal([]string{"main.go"}, names(<-a.Notifications()))
+	require.Equal([]string{"README.md"}, names(<-b.Notifications()))
+
+	require.NoError(a.Close())
+	_, ok := <-a.Notifications()
+	require.False(ok)
+	notify("c:1531594843:978:9:4", false)
+	require.Equal([]string{"README.md"}, names(<-b.Notifications()))
+
+	require.NoError(m.Close())
+	_, ok = <-b.Notifications()
+	require.False(ok)
+
+	var specs []interface{}
+	for _, args := range s.history() {
+		switch args[0] {
+		case "subscribe":
+			spec := args[3].(map[string]interface{})
+			specs = append(specs, []interface{}{
+				spec["expression"], spec["since"],
+			})
+		case "unsubscribe":
+			specs = append(specs, "unsubscribe")
+		}
+	}
+	require.Equal([]interface{}{
+		[]interface{}{
+			[]interface{}{"allof",
+				[]interface{}{"type", "f"},
+				[]interface{}{"suffix", "go"},
+			},
+			nil,
+		},
+		[]interface{}{
+			[]interface{}{"allof",
+				[]interface{}{"type", "f"},
+				[]interface{}{"anyof",
+					[]interface{}{"suffix", "go"},
+					[]interface{}{"suffix", "md"},
+				},
+			},
+			"c:1531594843:978:9:2",
+		},
+		[]interface{}{
+			[]interface{}{"allof",
+				[]interface{}{"type", "f"},
+				[]interface{}{"suffix", "md"},
+			},
+			"c:1531594843:978:9:3",
+		},
+		"unsubscribe",
+	}, specs)
+}
+
+func TestMultiplexerSlowSubscriber(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "term-anyof", "term-suffix")
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("unsubscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"unsubscribe": args[2],
+			"deleted":     true,
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	m := w.Multiplex("mux")
+	a, err := m.Subscribe(Suffix{Suffixes: []string{"go"}})
+	require.NoError(err)
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "mux",
+		"clock":        "c:1531594843:978:9:2",
+		"files": []interface{}{
+			map[string]interface{}{"name": "main.go", "exists": true},
+		},
+	})
+
+	// a is not receiving, so dispatch is waiting to deliver to it
+	b, err := m.Subscribe(Suffix{Suffixes: []string{"md"}})
+	require.NoError(err)
+	require.NoError(b.Close())
+	require.NoError(a.Close())
+	require.NoError(m.Close())
+}
+
+func TestMultiplexerDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "term-suffix")
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	m := w.Multiplex("mux")
+	a, err := m.Subscribe(Suffix{Suffixes: []string{"go"}})
+	require.NoError(err)
+
+	s.close()
+	select {
+	case _, ok := <-a.Notifications():
+		require.False(ok)
+	case <-time.After(time.Second):
+		require.Fail("notifications not closed")
+	}
+	require.NoError(a.Close())
+}
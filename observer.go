@@ -0,0 +1,78 @@
+package watchman
+
+import (
+	"time"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// An Observer receives callbacks that can be used to collect metrics
+// or traces. Callbacks are made synchronously, from many goroutines,
+// and must not block.
+//
+// See package watchman/metrics for an Observer that exports metrics.
+type Observer interface {
+	// RequestStarted is called before a request is sent.
+	RequestStarted(command string)
+	// RequestFinished is called when a request completes or fails.
+	RequestFinished(stats *RequestStats)
+	// NotificationDelivered is called when a subscription notification
+	// is delivered, with the time since the most recent change it
+	// includes, based on the ctime reported by the Watchman server. The
+	// ctime has a resolution of one second. If no change time is known,
+	// such as for a fresh instance, lag is the time since the
+	// notification was received.
+	NotificationDelivered(subscription string, lag time.Duration)
+	// NotificationsDropped is called when notifications are dropped by
+	// the overflow policy of a subscription, with the total for the
+	// subscription, as reported by Subscription.Dropped.
+	NotificationsDropped(subscription string, total uint64)
+	// QueueDepth is called with the number of notifications buffered for
+	// a subscription, after the number changes.
+	QueueDepth(subscription string, depth int)
+	// Reconnected is called when a ClientPool replaces a member that
+	// lost its connection.
+	Reconnected()
+}
+
+// RequestStats describe a completed request.
+type RequestStats struct {
+	Command string
+	Latency time.Duration
+	// Sent and Received are the sizes of the request and response on
+	// the wire, in bytes. Received is 0 if no response was received.
+	Sent     int
+	Received int
+	Err      error
+}
+
+// WithObserver sets an Observer to be notified of requests and
+// notifications.
+func WithObserver(o Observer) Option {
+	return func(opts *options) {
+		opts.observer = o
+	}
+}
+
+// observe sends a request using do, which records the sizes of the
+// request and response, and reports it to the observer.
+func observe(o Observer, req protocol.Request, do func(*RequestStats) (protocol.ResponsePDU, error)) (protocol.ResponsePDU, error) {
+	stats := &RequestStats{Command: command(req)}
+
+	o.RequestStarted(stats.Command)
+	start := time.Now()
+	pdu, err := do(stats)
+	stats.Latency = time.Since(start)
+	stats.Err = err
+	o.RequestFinished(stats)
+	return pdu, err
+}
+
+// command returns the name of the command sent by req.
+func command(req protocol.Request) string {
+	if args := req.Args(); len(args) > 0 {
+		name, _ := args[0].(string)
+		return name
+	}
+	return ""
+}
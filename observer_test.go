@@ -0,0 +1,135 @@
+package watchman
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+type recordingObserver struct {
+	mu         sync.Mutex
+	started    []string
+	finished   []RequestStats
+	delivered  []string
+	lags       []time.Duration
+	depths     []int
+	dropped    uint64
+	reconnects int
+}
+
+func (o *recordingObserver) RequestStarted(command string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, command)
+}
+
+func (o *recordingObserver) RequestFinished(stats *RequestStats) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, *stats)
+}
+
+func (o *recordingObserver) NotificationDelivered(subscription string, lag time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.delivered = append(o.delivered, subscription)
+	o.lags = append(o.lags, lag)
+}
+
+func (o *recordingObserver) NotificationsDropped(subscription string, total uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.dropped = total
+}
+
+func (o *recordingObserver) QueueDepth(subscription string, depth int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.depths = append(o.depths, depth)
+}
+
+func (o *recordingObserver) Reconnected() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.reconnects++
+}
+
+func TestObserver(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	o := &recordingObserver{}
+	p, err := NewClientPool(1, append(s.options(), WithObserver(o))...)
+	require.NoError(err)
+	defer p.Close()
+
+	_, err = p.Do(context.Background(), protocol.RawRequest{"noop"})
+	require.Error(err)
+
+	w := &Watch{client: p, root: "/tmp"}
+	_, err = w.SubscribeChanges("sub1", WithBuffer(1, DropOldest))
+	require.NoError(err)
+	changed := time.Now().Add(-time.Minute)
+	for i := 2; i < 6; i++ {
+		s.send(protocol.ResponsePDU{
+			"unilateral":   true,
+			"subscription": "sub1",
+			"clock":        fmt.Sprintf("c:1531594843:978:9:%d", i),
+			"files": []interface{}{
+				map[string]interface{}{
+					"name": "foo", "exists": true, "ctime": changed.Unix(),
+				},
+			},
+		})
+	}
+	require.Eventually(func() bool {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return o.dropped > 0
+	}, time.Second, time.Millisecond)
+	<-p.Notifications()
+	require.Eventually(func() bool {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return len(o.delivered) > 0
+	}, time.Second, time.Millisecond)
+
+	// the pool redials members that lost their connection
+	s.closeConn(1)
+	_, err = p.Do(context.Background(), protocol.RawRequest{"noop"})
+	require.Error(err)
+	require.Eventually(func() bool {
+		_, err = p.Do(context.Background(), protocol.RawRequest{"noop"})
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return o.reconnects == 1
+	}, time.Second, time.Millisecond)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	require.Equal("noop", o.started[0])
+	require.Equal("subscribe", o.started[1])
+	require.Equal("noop", o.finished[0].Command)
+	require.IsType(&protocol.WatchmanError{}, o.finished[0].Err)
+	require.Equal(len(`["noop"]`)+1, o.finished[0].Sent)
+	require.Greater(o.finished[0].Received, 0)
+	require.Equal("subscribe", o.finished[1].Command)
+	require.NoError(o.finished[1].Err)
+	require.Greater(o.finished[1].Received, 0)
+	require.Equal("sub1", o.delivered[0])
+	require.GreaterOrEqual(o.lags[0], time.Minute-time.Second)
+	require.NotEmpty(o.depths)
+}
@@ -0,0 +1,89 @@
+package watchman
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// An Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	connect    []protocol.Option
+	logHandler slog.Handler
+	observer   Observer
+	warner     *warner
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func connectOption(opt protocol.Option) Option {
+	return func(o *options) {
+		o.connect = append(o.connect, opt)
+	}
+}
+
+// WithBinary sets the path of the watchman executable used to locate,
+// and if necessary start, the Watchman server. By default, "watchman"
+// is found using PATH.
+func WithBinary(path string) Option {
+	return connectOption(protocol.WithBinary(path))
+}
+
+// WithDialer replaces the function used to open the connection to the
+// Watchman server.
+func WithDialer(dialer protocol.Dialer) Option {
+	return connectOption(protocol.WithDialer(dialer))
+}
+
+// WithDialTimeout limits how long Connect waits for the connection to
+// the Watchman server to open. The default is 30 seconds.
+func WithDialTimeout(timeout time.Duration) Option {
+	return connectOption(protocol.WithDialTimeout(timeout))
+}
+
+// WithLogHandler enables diagnostic logging by the Client and its
+// connection. In addition to the messages logged by the connection,
+// the routing of unilateral PDUs is logged at debug level, the server
+// closing the connection at info level, and any other cause of a lost
+// connection at warn level. By default, nothing is logged.
+func WithLogHandler(h slog.Handler) Option {
+	return func(o *options) {
+		o.logHandler = h
+		o.connect = append(o.connect, protocol.WithLogHandler(h))
+	}
+}
+
+// WithEnv replaces the environment, in the form "key=value", used to
+// read WATCHMAN_SOCK and to run the watchman executable. By default,
+// the environment of the current process is used.
+func WithEnv(env []string) Option {
+	return connectOption(protocol.WithEnv(env))
+}
+
+// WithOptionalCapabilities asks the Watchman server which of the listed
+// capabilities it supports, without failing if some are missing.
+func WithOptionalCapabilities(capabilities ...string) Option {
+	return connectOption(protocol.WithOptionalCapabilities(capabilities...))
+}
+
+// WithRequiredCapabilities causes Connect to fail with a
+// protocol.CapabilityError unless the Watchman server supports every
+// listed capability.
+func WithRequiredCapabilities(capabilities ...string) Option {
+	return connectOption(protocol.WithRequiredCapabilities(capabilities...))
+}
+
+// WithSockName sets the location of the socket used to communicate with
+// the Watchman server, skipping WATCHMAN_SOCK and `watchman get-sockname`.
+func WithSockName(sockname string) Option {
+	return connectOption(protocol.WithSockName(sockname))
+}
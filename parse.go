@@ -0,0 +1,345 @@
+package watchman
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A SyntaxError describes an expression that could not be parsed.
+type SyntaxError struct {
+	// Offset is the position in bytes where the error was found.
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// ParseExpr parses an expression written in a compact syntax, such as:
+//
+//	type:f && (suffix:go || suffix:mod) && !dirname:vendor
+//
+// Terms are combined using "&&", "||", "!" and parentheses, with "!"
+// binding tightest and "||" loosest. Values that contain spaces or
+// punctuation must be double quoted, using Go string syntax.
+//
+//	true, false, exists, empty
+//	match:PATTERN, imatch:PATTERN
+//	pcre:REGEXP, ipcre:REGEXP
+//	name:NAME[,NAME...], iname:NAME[,NAME...]
+//	dirname:PATH, idirname:PATH
+//	suffix:SUFFIX[,SUFFIX...]
+//	type:TYPE
+//	size:[OP]BYTES    where OP is one of = != > >= < <=
+//
+// The match, pcre, and name terms compare the base name of a file unless
+// the ".wholename" modifier is used, such as "match.wholename:src/**/*.go".
+// The match terms also accept ".dotfiles" to allow wildcards to match
+// names starting with a period.
+//
+// Expr.String returns expressions in the same syntax.
+func ParseExpr(s string) (Expr, error) {
+	p := &parser{input: s}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.done() {
+		return nil, p.errorf(p.pos, "unexpected %q", p.input[p.pos])
+	}
+	return e, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) errorf(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{
+		Offset: offset,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && strings.IndexByte(" \t\r\n", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// consume skips whitespace, and then tok if it is next.
+func (p *parser) consume(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	exprs := AnyOf{e}
+	for p.consume("||") {
+		if e, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	exprs := AllOf{e}
+	for p.consume("&&") {
+		if e, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.consume("!") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: e}, nil
+	}
+
+	if p.consume("(") {
+		start := p.pos - 1
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			if p.done() {
+				return nil, p.errorf(start, "unclosed parenthesis")
+			}
+			return nil, p.errorf(p.pos, "expected \")\", found %q", p.input[p.pos])
+		}
+		return e, nil
+	}
+
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.done() {
+		c := p.input[p.pos]
+		if c != '.' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos {
+		if p.done() {
+			return nil, p.errorf(p.pos, "unexpected end of expression")
+		}
+		return nil, p.errorf(p.pos, "unexpected %q", p.input[p.pos])
+	}
+
+	parts := strings.Split(p.input[start:p.pos], ".")
+	name, modifiers := parts[0], parts[1:]
+
+	var values []string
+	if !p.done() && p.input[p.pos] == ':' {
+		p.pos++
+		var err error
+		if values, err = p.parseValues(); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &termParser{p: p, offset: start, name: name, values: values}
+	for _, m := range modifiers {
+		switch {
+		case m == "wholename" && t.oneOf("match", "imatch", "pcre", "ipcre", "name", "iname"):
+			t.wholename = true
+		case m == "dotfiles" && t.oneOf("match", "imatch"):
+			t.dotfiles = true
+		default:
+			return nil, p.errorf(start, "unknown modifier %q for %s", m, name)
+		}
+	}
+	return t.build()
+}
+
+func (p *parser) parseValues() (values []string, err error) {
+	for {
+		var value string
+		if value, err = p.parseValue(); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.done() || p.input[p.pos] != ',' {
+			return values, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	start := p.pos
+	if !p.done() && p.input[p.pos] == '"' {
+		for p.pos++; !p.done(); p.pos++ {
+			switch p.input[p.pos] {
+			case '\\':
+				p.pos++
+			case '"':
+				p.pos++
+				value, err := strconv.Unquote(p.input[start:p.pos])
+				if err != nil {
+					return "", p.errorf(start, "invalid quoted string")
+				}
+				return value, nil
+			}
+		}
+		return "", p.errorf(start, "unterminated quoted string")
+	}
+
+	for !p.done() && strings.IndexByte(" \t\r\n()&|,\"", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf(start, "expected value")
+	}
+	return p.input[start:p.pos], nil
+}
+
+// termParser builds a single term from its name, modifiers, and values.
+type termParser struct {
+	p         *parser
+	offset    int
+	name      string
+	values    []string
+	wholename bool
+	dotfiles  bool
+}
+
+func (t *termParser) oneOf(names ...string) bool {
+	for _, name := range names {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the only value of the term.
+func (t *termParser) value() (string, error) {
+	if len(t.values) != 1 {
+		return "", t.p.errorf(t.offset, "%s requires exactly one value", t.name)
+	}
+	return t.values[0], nil
+}
+
+func (t *termParser) build() (Expr, error) {
+	switch t.name {
+	case "true", "false", "exists", "empty":
+		if len(t.values) > 0 {
+			return nil, t.p.errorf(t.offset, "%s does not take a value", t.name)
+		}
+		switch t.name {
+		case "true":
+			return True{}, nil
+		case "false":
+			return False{}, nil
+		case "exists":
+			return Exists{}, nil
+		}
+		return Empty{}, nil
+	case "name", "iname", "suffix":
+		if len(t.values) < 1 {
+			return nil, t.p.errorf(t.offset, "%s requires a value", t.name)
+		}
+		if t.name == "suffix" {
+			return Suffix{Suffixes: t.values}, nil
+		}
+		return Name{
+			Names:     t.values,
+			Wholename: t.wholename,
+			NoCase:    t.name == "iname",
+		}, nil
+	}
+
+	if !t.oneOf("match", "imatch", "pcre", "ipcre", "dirname", "idirname", "type", "size") {
+		return nil, t.p.errorf(t.offset, "unknown term %q", t.name)
+	}
+	value, err := t.value()
+	if err != nil {
+		return nil, err
+	}
+	switch t.name {
+	case "match", "imatch":
+		return Match{
+			Pattern:         value,
+			Wholename:       t.wholename,
+			NoCase:          t.name == "imatch",
+			IncludeDotFiles: t.dotfiles,
+		}, nil
+	case "pcre", "ipcre":
+		if _, err := compile(value, t.name == "ipcre"); err != nil {
+			return nil, t.p.errorf(t.offset, "invalid regular expression %q", value)
+		}
+		return PCRE{
+			Pattern:   value,
+			Wholename: t.wholename,
+			NoCase:    t.name == "ipcre",
+		}, nil
+	case "dirname", "idirname":
+		return DirName{
+			Path:   value,
+			NoCase: t.name == "idirname",
+		}, nil
+	case "type":
+		if len(value) != 1 || !strings.Contains("bcdfplsD", value) {
+			return nil, t.p.errorf(t.offset, "unknown file type %q", value)
+		}
+		return Type{Type: value}, nil
+	}
+	return t.size(value)
+}
+
+func (t *termParser) size(value string) (Expr, error) {
+	op := Eq
+	// check longer symbols first
+	for _, candidate := range []SizeOp{Ne, Ge, Le, Eq, Gt, Lt} {
+		if symbol := sizeOpSymbols[candidate]; strings.HasPrefix(value, symbol) {
+			op = candidate
+			value = value[len(symbol):]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return nil, t.p.errorf(t.offset, "invalid size %q", value)
+	}
+	return Size{Op: op, Value: n}, nil
+}
@@ -0,0 +1,131 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected Expr
+		printed  string
+	}{
+		{
+			input:    "true",
+			expected: True{},
+		},
+		{
+			input: "type:f && (suffix:go || suffix:mod) && !dirname:vendor",
+			expected: AllOf{
+				Type{Type: "f"},
+				AnyOf{
+					Suffix{Suffixes: []string{"go"}},
+					Suffix{Suffixes: []string{"mod"}},
+				},
+				Not{Expr: DirName{Path: "vendor"}},
+			},
+		},
+		{
+			input: "exists||empty&&!false",
+			expected: AnyOf{
+				Exists{},
+				AllOf{Empty{}, Not{Expr: False{}}},
+			},
+			printed: "exists || empty && !false",
+		},
+		{
+			input: "!(match:*.go || imatch.wholename.dotfiles:SRC/**)",
+			expected: Not{Expr: AnyOf{
+				Match{Pattern: "*.go"},
+				Match{
+					Pattern:         "SRC/**",
+					Wholename:       true,
+					NoCase:          true,
+					IncludeDotFiles: true,
+				},
+			}},
+			printed: "!(match:*.go || imatch.dotfiles.wholename:SRC/**)",
+		},
+		{
+			input: `pcre:"^(foo|bar)\\.go$" && ipcre.wholename:"a b"`,
+			expected: AllOf{
+				PCRE{Pattern: `^(foo|bar)\.go$`},
+				PCRE{Pattern: "a b", Wholename: true, NoCase: true},
+			},
+		},
+		{
+			input: "name:go.mod,go.sum || iname.wholename:README.md || suffix:c,h",
+			expected: AnyOf{
+				Name{Names: []string{"go.mod", "go.sum"}},
+				Name{Names: []string{"README.md"}, Wholename: true, NoCase: true},
+				Suffix{Suffixes: []string{"c", "h"}},
+			},
+		},
+		{
+			input: "size:>1024 && size:<=4096 && size:!=2048 && size:0 && idirname:Docs",
+			expected: AllOf{
+				Size{Op: Gt, Value: 1024},
+				Size{Op: Le, Value: 4096},
+				Size{Op: Ne, Value: 2048},
+				Size{Op: Eq, Value: 0},
+				DirName{Path: "Docs", NoCase: true},
+			},
+			printed: "size:>1024 && size:<=4096 && size:!=2048 && size:=0 && idirname:Docs",
+		},
+		{
+			input: "(exists && (empty && true)) || (false || type:d)",
+			expected: AnyOf{
+				AllOf{Exists{}, AllOf{Empty{}, True{}}},
+				AnyOf{False{}, Type{Type: "d"}},
+			},
+			printed: "exists && (empty && true) || (false || type:d)",
+		},
+	} {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			require := require.New(t)
+
+			actual, err := ParseExpr(tc.input)
+			require.NoError(err)
+			require.Equal(tc.expected, actual)
+
+			printed := tc.printed
+			if printed == "" {
+				printed = tc.input
+			}
+			require.Equal(printed, actual.String())
+
+			reparsed, err := ParseExpr(actual.String())
+			require.NoError(err)
+			require.Equal(tc.expected, reparsed)
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		offset int
+		msg    string
+	}{
+		{"", 0, "unexpected end of expression"},
+		{"type:f &&", 9, "unexpected end of expression"},
+		{"type:f && (suffix:go", 10, "unclosed parenthesis"},
+		{"type:f )", 7, `unexpected ')'`},
+		{"exists:yes", 0, "exists does not take a value"},
+		{"suffix:go && match:a,b", 13, "match requires exactly one value"},
+		{"exists && colour:red", 10, `unknown term "colour"`},
+		{"type:x", 0, `unknown file type "x"`},
+		{"size:>big", 0, `invalid size "big"`},
+		{`type:f || pcre:"(a"`, 10, `invalid regular expression "(a"`},
+		{"type.wholename:f", 0, `unknown modifier "wholename" for type`},
+		{`match:"*.go`, 6, "unterminated quoted string"},
+		{"match:", 6, "expected value"},
+		{"true && 42", 8, `unexpected '4'`},
+	} {
+		_, err := ParseExpr(tc.input)
+		require.Equal(t, &SyntaxError{Offset: tc.offset, Msg: tc.msg}, err, tc.input)
+	}
+}
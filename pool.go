@@ -0,0 +1,242 @@
+package watchman
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// A ClientPool spreads requests across several connections to the
+// Watchman server. Watchman processes one request at a time for each
+// connection, so a pool allows slow queries to run concurrently.
+//
+// Subscriptions are pinned to a dedicated connection, so that their
+// notifications are delivered by Notifications in order. If it is lost,
+// the dedicated connection is dialed again when the next subscription
+// is created. Other pool members that lose their connection are dialed
+// again when next used.
+//
+// A ClientPool is safe for concurrent use by multiple goroutines.
+type ClientPool struct {
+	opts     []Option
+	observer Observer
+
+	// subMu serializes replacing sub, without holding mu
+	subMu sync.Mutex
+	sub   *Client
+
+	mu      sync.Mutex
+	closed  bool
+	members []*Client
+	// redialing marks members being replaced, without holding mu
+	redialing []bool
+	// redialed is signaled when a member is no longer redialing
+	redialed *sync.Cond
+}
+
+// NewClientPool connects to or starts the Watchman server, and returns
+// a pool of size connections for requests, plus one connection for
+// subscriptions.
+func NewClientPool(size int, opts ...Option) (*ClientPool, error) {
+	if size < 1 {
+		return nil, errors.New("pool size must be at least 1")
+	}
+
+	p := &ClientPool{
+		opts:      opts,
+		observer:  newOptions(opts).observer,
+		members:   make([]*Client, size),
+		redialing: make([]bool, size),
+	}
+	p.redialed = sync.NewCond(&p.mu)
+	var err error
+	if p.sub, err = Connect(opts...); err != nil {
+		return nil, err
+	}
+	for i := range p.members {
+		if p.members[i], err = Connect(opts...); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// member returns the connected pool member with the fewest requests in
+// progress, replacing members that have lost their connection.
+//
+// Members are dialed again without holding mu, so that other callers
+// can use the remaining members in the meantime. Callers only wait if
+// every member is being replaced.
+func (p *ClientPool) member() (*Client, error) {
+	p.mu.Lock()
+	var best *Client
+	var dead []int
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrClosed
+		}
+		for i, c := range p.members {
+			switch {
+			case p.redialing[i]:
+			case c.closed():
+				p.redialing[i] = true
+				dead = append(dead, i)
+			case best == nil || c.loop.load() < best.loop.load():
+				best = c
+			}
+		}
+		if best != nil || len(dead) > 0 {
+			break
+		}
+		p.redialed.Wait()
+	}
+	p.mu.Unlock()
+
+	var err error
+	for _, i := range dead {
+		var c *Client
+		if c, err = p.redial(i); err != nil {
+			continue
+		}
+		if best == nil || c.loop.load() < best.loop.load() {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// redial replaces the member at index i, which must be marked as
+// redialing by the caller.
+func (p *ClientPool) redial(i int) (*Client, error) {
+	c, err := Connect(p.opts...)
+
+	p.mu.Lock()
+	defer p.redialed.Broadcast()
+	defer p.mu.Unlock()
+
+	p.redialing[i] = false
+	if err != nil {
+		return nil, err
+	}
+	if p.closed {
+		c.Close()
+		return nil, ErrClosed
+	}
+	p.members[i].Close()
+	p.members[i] = c
+	if p.observer != nil {
+		p.observer.Reconnected()
+	}
+	return c, nil
+}
+
+// AddWatch requests that the Watchman server monitor a directory for
+// changes. Requests made using the returned Watch are spread across
+// the pool.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/watch-project.html
+func (p *ClientPool) AddWatch(path string) (*Watch, error) {
+	return addWatch(p, path)
+}
+
+// Close closes every connection in the pool.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.redialed.Broadcast()
+	members := append([]*Client(nil), p.members...)
+	p.mu.Unlock()
+
+	for _, c := range members {
+		if c != nil {
+			c.Close()
+		}
+	}
+	return p.current().Close()
+}
+
+// Do sends an arbitrary request using the least busy pool member.
+// See Client.Do for details.
+func (p *ClientPool) Do(ctx context.Context, req protocol.Request) (protocol.ResponsePDU, error) {
+	c, err := p.member()
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req)
+}
+
+func (p *ClientPool) send(req protocol.Request) (protocol.ResponsePDU, error) {
+	c, err := p.member()
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
+
+// subscriber returns the connection for subscriptions, dialing it again
+// if it was lost. If dialing fails, the lost connection is returned, so
+// that requests using it fail with ErrClosed.
+func (p *ClientPool) subscriber() *Client {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	if !p.sub.closed() {
+		return p.sub
+	}
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return p.sub
+	}
+	c, err := Connect(p.opts...)
+	if err != nil {
+		return p.sub
+	}
+	p.sub = c
+	if p.observer != nil {
+		p.observer.Reconnected()
+	}
+	return c
+}
+
+// current returns the connection for subscriptions, without replacing
+// it if it was lost.
+func (p *ClientPool) current() *Client {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	return p.sub
+}
+
+// HasCapability checks if the Watchman server supports a feature.
+//
+// For details, see: https://facebook.github.io/watchman/docs/capabilities.html
+func (p *ClientPool) HasCapability(capability string) bool {
+	return p.current().HasCapability(capability)
+}
+
+// ListWatches returns a list of directories that Watchman is monitoring.
+func (p *ClientPool) ListWatches() ([]string, error) {
+	return listWatches(p)
+}
+
+// Notifications returns a channel that emits unilateral messages from
+// the Watchman server, including notifications for every subscription
+// created using the pool. The channel is closed if the connection used
+// for subscriptions is lost. Once subscriptions are created again, using
+// a new connection, Notifications returns a new channel.
+func (p *ClientPool) Notifications() <-chan Event {
+	return p.current().Notifications()
+}
+
+// Version returns the version of the Watchman server.
+func (p *ClientPool) Version() string {
+	return p.current().Version()
+}
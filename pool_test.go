@@ -0,0 +1,174 @@
+package watchman
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestClientPool(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"watch": args[1]}
+	})
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock": "c:1531594843:978:9:346",
+			"files": []interface{}{},
+		}
+	})
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:346",
+			"subscribe": args[2],
+		}
+	})
+
+	_, err := NewClientPool(0, s.options()...)
+	require.Error(err)
+
+	p, err := NewClientPool(3, s.options()...)
+	require.NoError(err)
+	defer p.Close()
+	require.Equal("4.9.0", p.Version())
+
+	w, err := p.AddWatch("/tmp")
+	require.NoError(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := w.Query(&Query{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	sub, err := w.SubscribeChanges("sub1")
+	require.NoError(err)
+	require.Same(p.subscriber(), sub.client)
+
+	// connection 0 is reserved for subscriptions
+	require.Equal([]string{"list-capabilities", "subscribe"}, s.historyOf(0))
+	for i := 1; i <= 3; i++ {
+		require.NotContains(s.historyOf(i), "subscribe")
+	}
+
+	s.sendTo(0, protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock":        "c:1531594843:978:9:347",
+		"files":        []interface{}{},
+	})
+	cn := (<-p.Notifications()).(*ChangeNotification)
+	require.Equal("sub1", cn.Subscription)
+
+	// lost connections are replaced
+	for i := 1; i <= 3; i++ {
+		s.closeConn(i)
+	}
+	for _, c := range p.members {
+		<-c.loop.done
+	}
+	_, err = p.Do(context.Background(), protocol.RawRequest{"query", "/tmp", map[string]interface{}{}})
+	require.NoError(err)
+	require.Len(s.history(), 4+1+30+1+3+1)
+}
+
+func TestClientPoolRedial(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("version", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{}
+	})
+
+	var slow sync.Mutex
+	dialing := make(chan struct{}, 1)
+	dial := func(sockname string, timeout time.Duration) (net.Conn, error) {
+		select {
+		case dialing <- struct{}{}:
+		default:
+		}
+		slow.Lock()
+		defer slow.Unlock()
+		return s.dial(sockname, timeout)
+	}
+
+	p, err := NewClientPool(2, append(s.options(), WithDialer(dial))...)
+	require.NoError(err)
+	defer p.Close()
+	<-dialing
+
+	s.closeConn(1)
+	<-p.members[0].loop.done
+
+	// the request that finds the lost member waits for it to be replaced
+	slow.Lock()
+	replaced := make(chan error)
+	go func() {
+		_, err := p.Do(context.Background(), protocol.RawRequest{"version"})
+		replaced <- err
+	}()
+	<-dialing
+
+	// while other requests use the remaining member
+	_, err = p.Do(context.Background(), protocol.RawRequest{"version"})
+	require.NoError(err)
+
+	slow.Unlock()
+	require.NoError(<-replaced)
+	require.False(p.members[0].closed())
+}
+
+func TestClientPoolResubscribe(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:346",
+			"subscribe": args[2],
+		}
+	})
+
+	p, err := NewClientPool(1, s.options()...)
+	require.NoError(err)
+	defer p.Close()
+
+	w := &Watch{client: p, root: "/tmp"}
+	_, err = w.SubscribeChanges("sub1")
+	require.NoError(err)
+	lost := p.Notifications()
+
+	// connection 0 is reserved for subscriptions
+	s.closeConn(0)
+	for range lost {
+	}
+
+	// the dedicated connection is replaced by the next subscription
+	sub, err := w.SubscribeChanges("sub1")
+	require.NoError(err)
+	require.Same(p.subscriber(), sub.client)
+	require.Equal([]string{"list-capabilities", "subscribe"}, s.historyOf(2))
+
+	s.sendTo(2, protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock":        "c:1531594843:978:9:347",
+		"files":        []interface{}{},
+	})
+	cn := (<-p.Notifications()).(*ChangeNotification)
+	require.Equal("sub1", cn.Subscription)
+}
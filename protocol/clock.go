@@ -25,6 +25,14 @@ func (req *ClockRequest) Args() []interface{} {
 	return []interface{}{"clock", req.Path, m}
 }
 
+// RequiredCapabilities returns the capabilities needed by the request.
+func (req *ClockRequest) RequiredCapabilities() []string {
+	if req.SyncTimeout < 1 {
+		return nil
+	}
+	return []string{"clock-sync-timeout"}
+}
+
 // A ClockResponse represents a response to the Watchman clock command.
 type ClockResponse struct {
 	response
@@ -6,54 +6,105 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"os"
+	"log/slog"
 	"os/exec"
-	"time"
+	"sync"
 )
 
 // Connection provides a low-level interface to the Watchman service.
 type Connection struct {
+	logger *slog.Logger
 	reader *bufio.Reader
 	socket io.Writer
 	// metadata
 	capabilities map[string]struct{}
 	sockname     string
 	version      string
+
+	closeOnce sync.Once
 }
 
 // Connect connects to or starts the Watchman server and returns a new Connection.
-func Connect() (*Connection, error) {
-	sockname, err := sockname()
+func Connect(opts ...Option) (*Connection, error) {
+	o := newOptions(opts)
+	logger := NewLogger(o.logHandler)
+	sockname, err := sockname(o)
 	if err != nil {
+		logger.Error("unable to find watchman socket", slog.Any("error", err))
 		return nil, err
 	}
 
-	socket, err := dial(sockname, 30*time.Second)
+	logger.Debug("dialing", slog.String("sockname", sockname))
+	socket, err := o.dialer(sockname, o.dialTimeout)
 	if err != nil {
+		logger.Error("dial failed",
+			slog.String("sockname", sockname),
+			slog.Any("error", err),
+		)
 		return nil, err
 	}
 
+	o.sockname = sockname
+	return newConnection(socket, o)
+}
+
+// NewConnection returns a new Connection that communicates with the
+// Watchman server over an already established stream, such as a
+// forwarded socket or one end of a net.Pipe. The stream is closed if
+// the initial handshake with the server fails.
+//
+// Options that control how to find and dial the server are ignored,
+// except that WithSockName sets the value reported by SockName.
+func NewConnection(rwc io.ReadWriteCloser, opts ...Option) (*Connection, error) {
+	return newConnection(rwc, newOptions(opts))
+}
+
+func newConnection(rwc io.ReadWriteCloser, o *options) (*Connection, error) {
 	c := &Connection{
-		reader:   bufio.NewReader(socket),
-		socket:   socket,
-		sockname: sockname,
+		logger:   NewLogger(o.logHandler),
+		reader:   bufio.NewReader(rwc),
+		socket:   rwc,
+		sockname: o.sockname,
 	}
-	err = c.init()
+	err := c.init(o.required, o.optional)
 	if err != nil {
+		c.log().Error("handshake failed", slog.Any("error", err))
+		rwc.Close()
 		return nil, err
 	}
 
+	c.log().Info("connected",
+		slog.String("sockname", c.sockname),
+		slog.String("version", c.version),
+	)
 	return c, nil
 }
 
 // Close closes the connection to the Watchman server.
 func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		c.log().Info("disconnecting")
+	})
 	if x, ok := c.socket.(io.Closer); ok {
 		return x.Close()
 	}
 	return nil
 }
 
+// CheckCapabilities returns a CapabilityError if req implements
+// CapabilityRequirer and the Watchman server does not support every
+// capability it requires.
+func (c *Connection) CheckCapabilities(req Request) error {
+	r, ok := req.(CapabilityRequirer)
+	if !ok {
+		return nil
+	}
+	if missing := c.missing(r.RequiredCapabilities()); len(missing) > 0 {
+		return &CapabilityError{Missing: missing}
+	}
+	return nil
+}
+
 // HasCapability checks if the Watchman server supports a specific feature.
 func (c *Connection) HasCapability(capability string) bool {
 	_, ok := c.capabilities[capability]
@@ -70,7 +121,7 @@ func (c *Connection) Version() string {
 	return c.version
 }
 
-func (c *Connection) init() (err error) {
+func (c *Connection) init(required, optional []string) (err error) {
 	if err = c.Send(&ListCapabilitiesRequest{}); err != nil {
 		return
 	}
@@ -88,51 +139,139 @@ func (c *Connection) init() (err error) {
 	c.capabilities = capset
 	c.version = res.Version()
 
+	if len(required) > 0 || len(optional) > 0 {
+		err = c.negotiate(required, optional)
+	}
+	return
+}
+
+func (c *Connection) missing(capabilities []string) (missing []string) {
+	for _, capability := range capabilities {
+		if !c.HasCapability(capability) {
+			missing = append(missing, capability)
+		}
+	}
 	return
 }
 
+func (c *Connection) negotiate(required, optional []string) error {
+	err := c.Send(&VersionRequest{
+		Required: required,
+		Optional: optional,
+	})
+	if err != nil {
+		return err
+	}
+
+	pdu, err := c.Recv()
+	if _, ok := err.(*WatchmanError); ok {
+		if missing := c.missing(required); len(missing) > 0 {
+			return &CapabilityError{Missing: missing}
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	res := NewVersionResponse(pdu)
+	var missing []string
+	for _, capability := range required {
+		if !res.Capabilities()[capability] {
+			missing = append(missing, capability)
+		}
+	}
+	if len(missing) > 0 {
+		return &CapabilityError{Missing: missing}
+	}
+
+	for capability, supported := range res.Capabilities() {
+		if supported {
+			c.capabilities[capability] = struct{}{}
+		}
+	}
+	return nil
+}
+
 // Recv reads and decodes a response PDU from the Watchman server.
-func (c *Connection) Recv() (pdu ResponsePDU, err error) {
+func (c *Connection) Recv() (ResponsePDU, error) {
+	pdu, _, err := c.RecvN()
+	return pdu, err
+}
+
+// RecvN is like Recv, but also returns the size of the encoded PDU in
+// bytes, including the trailing newline.
+func (c *Connection) RecvN() (ResponsePDU, int, error) {
+	return c.recv(decodePDU)
+}
+
+// RecvRawFiles is like RecvN, but leaves the "files" of query responses
+// and subscription notifications encoded as a json.RawMessage, so that
+// TypedFiles can decode them without allocating a map for each file.
+// Files decodes them on demand, and ExpandFiles restores the shape of a
+// ResponsePDU returned by Recv.
+func (c *Connection) RecvRawFiles() (ResponsePDU, int, error) {
+	return c.recv(decodePDURawFiles)
+}
+
+func (c *Connection) recv(decode func([]byte) (ResponsePDU, error)) (pdu ResponsePDU, n int, err error) {
 	line, err := c.reader.ReadBytes('\n')
 	if err != nil {
-		return nil, err
+		return nil, len(line), err
 	}
+	n = len(line)
+	logPDU(c.log(), "received PDU", bytes.TrimSuffix(line, []byte("\n")))
 
-	if err = json.Unmarshal(line, &pdu); err != nil {
-		return nil, err
+	if pdu, err = decode(line); err != nil {
+		c.log().Error("unable to decode PDU", slog.Any("error", err))
+		return nil, n, err
 	} else if msg, ok := pdu["error"]; ok {
-		err = &WatchmanError{msg: msg.(string)}
-		return nil, err
+		text, _ := msg.(string)
+		err = &WatchmanError{msg: text, pdu: pdu}
+		return nil, n, err
 	}
 
 	return
 }
 
 // Send encodes and sends a request PDU to the Watchman server.
-func (c *Connection) Send(req Request) (err error) {
+func (c *Connection) Send(req Request) error {
+	_, err := c.SendN(req)
+	return err
+}
+
+// SendN is like Send, but also returns the number of bytes written,
+// including the trailing newline.
+func (c *Connection) SendN(req Request) (n int, err error) {
 	args := req.Args()
 	b, err := json.Marshal(args)
 	if err != nil {
 		return
 	}
+	logPDU(c.log(), "sending PDU", b)
 
-	_, err = c.socket.Write(b)
+	n, err = c.socket.Write(b)
 	if err != nil {
 		return
 	}
 
-	_, err = c.socket.Write([]byte("\n"))
+	m, err := c.socket.Write([]byte("\n"))
+	n += m
 	return
 }
 
-func sockname() (string, error) {
-	sockname := os.Getenv("WATCHMAN_SOCK")
+func sockname(o *options) (string, error) {
+	if o.sockname != "" {
+		return o.sockname, nil
+	}
+
+	sockname := o.getenv("WATCHMAN_SOCK")
 	if sockname != "" {
 		return sockname, nil
 	}
 
 	buffer := &bytes.Buffer{}
-	cmd := exec.Command("watchman", "get-sockname")
+	cmd := exec.Command(o.binary, "get-sockname")
+	cmd.Env = o.env
 	cmd.Stdout = buffer
 	if err := cmd.Run(); err != nil {
 		return "", err
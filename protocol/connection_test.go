@@ -0,0 +1,193 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionInit(t *testing.T) {
+	require := require.New(t)
+
+	const capabilities = `{"version":"4.9.0","capabilities":` +
+		`["cmd-clock","relative_root","term-match"]}` + "\n"
+
+	for _, tc := range []struct {
+		required  []string
+		optional  []string
+		request   string
+		responses []string
+		missing   []string
+		supported []string
+	}{
+		{
+			request:   `["list-capabilities"]` + "\n",
+			responses: []string{capabilities},
+			supported: []string{"cmd-clock", "relative_root", "term-match"},
+		},
+		{
+			required: []string{"term-match"},
+			optional: []string{"grant-three-wishes"},
+			request: `["list-capabilities"]` + "\n" +
+				`["version",{"optional":["grant-three-wishes"],"required":["term-match"]}]` + "\n",
+			responses: []string{
+				capabilities,
+				`{"version":"4.9.0","capabilities":` +
+					`{"grant-three-wishes":false,"term-match":true}}` + "\n",
+			},
+			supported: []string{"cmd-clock", "relative_root", "term-match"},
+		},
+		{
+			required: []string{"grant-three-wishes", "term-match"},
+			request: `["list-capabilities"]` + "\n" +
+				`["version",{"required":["grant-three-wishes","term-match"]}]` + "\n",
+			responses: []string{
+				capabilities,
+				`{"version":"4.9.0","error":"client required capability ` +
+					"`grant-three-wishes`" + ` is not supported by this server",` +
+					`"capabilities":{"grant-three-wishes":false,"term-match":true}}` + "\n",
+			},
+			missing: []string{"grant-three-wishes"},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				strings.NewReader(strings.Join(tc.responses, "")),
+			),
+			socket: requested,
+		}
+
+		err := c.init(tc.required, tc.optional)
+		require.Equal(tc.request, requested.String())
+		if tc.missing != nil {
+			require.Equal(&CapabilityError{Missing: tc.missing}, err)
+			require.Contains(err.Error(), "grant-three-wishes")
+			continue
+		}
+		require.NoError(err)
+		require.Equal("4.9.0", c.Version())
+		for _, capability := range tc.supported {
+			require.True(c.HasCapability(capability))
+		}
+		require.False(c.HasCapability("grant-three-wishes"))
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	require := require.New(t)
+
+	c := &Connection{
+		capabilities: map[string]struct{}{"cmd-clock": {}},
+	}
+	require.NoError(c.CheckCapabilities(&WatchListRequest{}))
+	require.NoError(c.CheckCapabilities(&ClockRequest{Path: "/tmp"}))
+	require.Equal(
+		&CapabilityError{Missing: []string{"clock-sync-timeout"}},
+		c.CheckCapabilities(&ClockRequest{Path: "/tmp", SyncTimeout: 100}),
+	)
+}
+
+func TestNewConnection(t *testing.T) {
+	require := require.New(t)
+
+	client, server := net.Pipe()
+	go func() {
+		r := bufio.NewReader(server)
+		if _, err := r.ReadBytes('\n'); err != nil {
+			return
+		}
+		server.Write([]byte(
+			`{"version":"4.9.0","capabilities":["cmd-watch-list"]}` + "\n",
+		))
+		if _, err := r.ReadBytes('\n'); err != nil {
+			return
+		}
+		server.Write([]byte(
+			`{"version":"4.9.0","roots":["/tmp"]}` + "\n",
+		))
+		server.Close()
+	}()
+
+	c, err := NewConnection(client, WithSockName("pipe"))
+	require.NoError(err)
+	require.Equal("pipe", c.SockName())
+	require.Equal("4.9.0", c.Version())
+	require.True(c.HasCapability("cmd-watch-list"))
+
+	err = c.Send(&WatchListRequest{})
+	require.NoError(err)
+
+	pdu, err := c.Recv()
+	require.NoError(err)
+	require.Equal([]string{"/tmp"}, NewWatchListResponse(pdu).Roots())
+
+	_, err = c.Recv()
+	require.Equal(io.EOF, err)
+	require.NoError(c.Close())
+
+	client, server = net.Pipe()
+	go func() {
+		r := bufio.NewReader(server)
+		r.ReadBytes('\n')
+		server.Close()
+	}()
+
+	c, err = NewConnection(client)
+	require.Nil(c)
+	require.Equal(io.EOF, err)
+
+	_, err = client.Write([]byte("\n"))
+	require.Equal(io.ErrClosedPipe, err)
+}
+
+func TestRecvError(t *testing.T) {
+	require := require.New(t)
+
+	c := &Connection{
+		reader: bufio.NewReader(strings.NewReader(
+			`{"version":"4.9.0","error":"unable to resolve root /tmp/x"}` + "\n",
+		)),
+	}
+
+	pdu, err := c.Recv()
+	require.Nil(pdu)
+	require.IsType(&WatchmanError{}, err)
+	require.Equal("unable to resolve root /tmp/x", err.Error())
+	require.Equal(ResponsePDU{
+		"version": "4.9.0",
+		"error":   "unable to resolve root /tmp/x",
+	}, err.(*WatchmanError).PDU())
+}
+
+func TestSendRecvN(t *testing.T) {
+	require := require.New(t)
+
+	sent := &bytes.Buffer{}
+	c := &Connection{
+		reader: bufio.NewReader(strings.NewReader(
+			`{"version":"4.9.0","roots":["/tmp"]}` + "\n" +
+				`{"version":"4.9.0","error":"failed"}` + "\n",
+		)),
+		socket: sent,
+	}
+
+	n, err := c.SendN(&WatchListRequest{})
+	require.NoError(err)
+	require.Equal(sent.Len(), n)
+	require.Equal(len(`["watch-list"]`+"\n"), n)
+
+	pdu, n, err := c.RecvN()
+	require.NoError(err)
+	require.NotNil(pdu)
+	require.Equal(len(`{"version":"4.9.0","roots":["/tmp"]}`+"\n"), n)
+
+	_, n, err = c.RecvN()
+	require.IsType(&WatchmanError{}, err)
+	require.Equal(len(`{"version":"4.9.0","error":"failed"}`+"\n"), n)
+}
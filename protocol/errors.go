@@ -1,11 +1,29 @@
 package protocol
 
+import "strings"
+
 // WatchmanError is returned when the Watchman server responds to a
 // request with an error instead of a normal response.
 type WatchmanError struct {
 	msg string
+	pdu ResponsePDU
 }
 
 func (e *WatchmanError) Error() string {
 	return e.msg
 }
+
+// PDU returns the response that reported the error.
+func (e *WatchmanError) PDU() ResponsePDU {
+	return e.pdu
+}
+
+// CapabilityError is returned when the Watchman server does not support
+// one or more capabilities required by the client.
+type CapabilityError struct {
+	Missing []string
+}
+
+func (e *CapabilityError) Error() string {
+	return "unsupported capabilities: " + strings.Join(e.Missing, ", ")
+}
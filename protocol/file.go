@@ -0,0 +1,469 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// A File is an entry in the files of a query response or subscription
+// notification, decoded from the fields requested by default.
+type File struct {
+	Name          string
+	Exists        bool
+	Type          string
+	Size          int64
+	Mode          int64
+	UID           int64
+	GID           int64
+	NLink         int64
+	MTime         int64
+	CTime         int64
+	CClock        string
+	OClock        string
+	SymlinkTarget string
+	// ContentSHA1 is the hex encoded SHA-1 hash of a regular file's
+	// content, if the content.sha1hex field was requested.
+	ContentSHA1 string
+}
+
+func newFile(m map[string]interface{}) (f File) {
+	f.Name, _ = m["name"].(string)
+	f.Exists, _ = m["exists"].(bool)
+	f.Type, _ = m["type"].(string)
+	f.CClock, _ = m["cclock"].(string)
+	f.OClock, _ = m["oclock"].(string)
+	f.SymlinkTarget, _ = m["symlink_target"].(string)
+	// the hash is null for directories, or an error object if the
+	// file could not be read
+	f.ContentSHA1, _ = m["content.sha1hex"].(string)
+	f.Size = intValue(m["size"])
+	f.Mode = intValue(m["mode"])
+	f.UID = intValue(m["uid"])
+	f.GID = intValue(m["gid"])
+	f.NLink = intValue(m["nlink"])
+	f.MTime = intValue(m["mtime"])
+	f.CTime = intValue(m["ctime"])
+	return
+}
+
+func intValue(x interface{}) int64 {
+	if n, ok := x.(float64); ok {
+		return int64(n)
+	}
+	return 0
+}
+
+// files converts the files of a PDU to maps.
+func files(x interface{}) (result []map[string]interface{}) {
+	if raw, ok := x.(json.RawMessage); ok {
+		x = nil
+		if err := json.Unmarshal(raw, &x); err != nil {
+			return
+		}
+	}
+	if files, ok := x.([]interface{}); ok {
+		result = make([]map[string]interface{}, 0, len(files))
+		for _, file := range files {
+			if data, ok := file.(map[string]interface{}); ok {
+				result = append(result, data)
+			}
+		}
+	}
+	return
+}
+
+// typedFiles converts the files of a PDU to Files, decoding directly
+// from JSON if possible.
+func typedFiles(x interface{}) []File {
+	if raw, ok := x.(json.RawMessage); ok {
+		if result, ok := decodeFiles(raw); ok {
+			return result
+		}
+	}
+	maps := files(x)
+	result := make([]File, len(maps))
+	for i, m := range maps {
+		result[i] = newFile(m)
+	}
+	return result
+}
+
+// findFiles returns the offsets of the "files" value of an encoded PDU,
+// without decoding it. The other values are skipped, but not validated.
+func findFiles(b []byte) (start, end int, ok bool) {
+	d := &fileDecoder{data: b}
+	if !d.consume('{') || d.consume('}') {
+		return 0, 0, false
+	}
+	for {
+		key, escaped, ok := d.rawString()
+		if !ok || !d.consume(':') {
+			return 0, 0, false
+		}
+		d.skipSpace()
+		start := d.pos
+		if !d.skip() {
+			return 0, 0, false
+		}
+		if !escaped && string(key) == "files" {
+			return start, d.pos, true
+		}
+		if !d.consume(',') {
+			return 0, 0, false
+		}
+	}
+}
+
+// Indexes of the string fields of a File that are copied to the shared
+// buffer of a fileDecoder.
+const (
+	nameField = iota
+	cclockField
+	oclockField
+	targetField
+	sha1Field
+	stringFields
+)
+
+type span struct {
+	start, end int
+}
+
+// A fileDecoder decodes a JSON array of file objects into Files. The
+// contents of every string are collected in one buffer, which is
+// converted to a string once, so that decoding allocates a constant
+// number of times regardless of the number of files.
+//
+// The input must be valid JSON. Decoding fails if a file is not an
+// object, or has a field not included in File, so that the caller can
+// fall back to decoding maps.
+type fileDecoder struct {
+	data []byte
+	pos  int
+	strs []byte
+}
+
+func decodeFiles(data []byte) ([]File, bool) {
+	d := &fileDecoder{
+		data: data,
+		strs: make([]byte, 0, len(data)/2),
+	}
+	return d.decode()
+}
+
+func (d *fileDecoder) decode() ([]File, bool) {
+	if d.literal("null") {
+		return nil, d.end()
+	}
+	if !d.consume('[') {
+		return nil, false
+	}
+
+	n := bytes.Count(d.data, []byte{'{'})
+	files := make([]File, 0, n)
+	spans := make([][stringFields]span, 0, n)
+	if !d.consume(']') {
+		for {
+			var f File
+			var s [stringFields]span
+			if !d.object(&f, &s) {
+				return nil, false
+			}
+			files = append(files, f)
+			spans = append(spans, s)
+			if d.consume(',') {
+				continue
+			}
+			if d.consume(']') {
+				break
+			}
+			return nil, false
+		}
+	}
+	if !d.end() {
+		return nil, false
+	}
+
+	strs := string(d.strs)
+	for i := range files {
+		f, s := &files[i], &spans[i]
+		f.Name = strs[s[nameField].start:s[nameField].end]
+		f.CClock = strs[s[cclockField].start:s[cclockField].end]
+		f.OClock = strs[s[oclockField].start:s[oclockField].end]
+		f.SymlinkTarget = strs[s[targetField].start:s[targetField].end]
+		f.ContentSHA1 = strs[s[sha1Field].start:s[sha1Field].end]
+	}
+	return files, true
+}
+
+func (d *fileDecoder) object(f *File, s *[stringFields]span) bool {
+	if !d.consume('{') {
+		return false
+	}
+	if d.consume('}') {
+		return true
+	}
+	for {
+		key, escaped, ok := d.rawString()
+		if !ok || escaped || !d.consume(':') {
+			return false
+		}
+		if !d.field(key, f, s) {
+			return false
+		}
+		if d.consume(',') {
+			continue
+		}
+		return d.consume('}')
+	}
+}
+
+func (d *fileDecoder) field(key []byte, f *File, s *[stringFields]span) bool {
+	switch string(key) {
+	case "name":
+		return d.str(&s[nameField])
+	case "exists":
+		return d.boolean(&f.Exists)
+	case "type":
+		return d.fileType(&f.Type)
+	case "size":
+		return d.integer(&f.Size)
+	case "mode":
+		return d.integer(&f.Mode)
+	case "uid":
+		return d.integer(&f.UID)
+	case "gid":
+		return d.integer(&f.GID)
+	case "nlink":
+		return d.integer(&f.NLink)
+	case "mtime":
+		return d.integer(&f.MTime)
+	case "ctime":
+		return d.integer(&f.CTime)
+	case "cclock":
+		return d.str(&s[cclockField])
+	case "oclock":
+		return d.str(&s[oclockField])
+	case "symlink_target":
+		return d.str(&s[targetField])
+	case "content.sha1hex":
+		// the hash is null for directories, or an error object if
+		// the file could not be read
+		if d.peek() != '"' {
+			return d.skip()
+		}
+		return d.str(&s[sha1Field])
+	}
+	return false
+}
+
+func (d *fileDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\r', '\n':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *fileDecoder) peek() byte {
+	d.skipSpace()
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+	return 0
+}
+
+func (d *fileDecoder) consume(c byte) bool {
+	if d.peek() == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *fileDecoder) end() bool {
+	d.skipSpace()
+	return d.pos == len(d.data)
+}
+
+func (d *fileDecoder) literal(s string) bool {
+	d.skipSpace()
+	if bytes.HasPrefix(d.data[d.pos:], []byte(s)) {
+		d.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// rawString returns the contents of a string, without decoding escape
+// sequences.
+func (d *fileDecoder) rawString() (b []byte, escaped, ok bool) {
+	if !d.consume('"') {
+		return nil, false, false
+	}
+	start := d.pos
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case '"':
+			d.pos++
+			return d.data[start : d.pos-1], escaped, true
+		case '\\':
+			escaped = true
+			d.pos++
+		}
+		d.pos++
+	}
+	return nil, false, false
+}
+
+// str appends a string, or nothing if it is null, to the shared buffer.
+func (d *fileDecoder) str(s *span) bool {
+	if d.literal("null") {
+		return true
+	}
+	start := d.pos
+	b, escaped, ok := d.rawString()
+	if !ok {
+		return false
+	}
+	s.start = len(d.strs)
+	if escaped {
+		var decoded string
+		if err := json.Unmarshal(d.data[start:d.pos], &decoded); err != nil {
+			return false
+		}
+		d.strs = append(d.strs, decoded...)
+	} else {
+		d.strs = append(d.strs, b...)
+	}
+	s.end = len(d.strs)
+	return true
+}
+
+// fileType decodes a type without allocating for the types used by
+// the Watchman server.
+func (d *fileDecoder) fileType(t *string) bool {
+	if d.literal("null") {
+		return true
+	}
+	b, escaped, ok := d.rawString()
+	if !ok || escaped {
+		return false
+	}
+	switch string(b) {
+	case "b":
+		*t = "b"
+	case "c":
+		*t = "c"
+	case "d":
+		*t = "d"
+	case "f":
+		*t = "f"
+	case "p":
+		*t = "p"
+	case "l":
+		*t = "l"
+	case "s":
+		*t = "s"
+	case "D":
+		*t = "D"
+	case "?":
+		*t = "?"
+	default:
+		*t = string(b)
+	}
+	return true
+}
+
+func (d *fileDecoder) boolean(v *bool) bool {
+	switch {
+	case d.literal("true"):
+		*v = true
+	case d.literal("false"):
+		*v = false
+	case d.literal("null"):
+	default:
+		return false
+	}
+	return true
+}
+
+func (d *fileDecoder) integer(v *int64) bool {
+	if d.literal("null") {
+		return true
+	}
+	start := d.pos
+	for d.pos < len(d.data) && bytes.IndexByte([]byte("+-.0123456789Ee"), d.data[d.pos]) >= 0 {
+		d.pos++
+	}
+	b := d.data[start:d.pos]
+
+	// fast path for integers that cannot overflow
+	neg := len(b) > 0 && b[0] == '-'
+	digits := b
+	if neg {
+		digits = b[1:]
+	}
+	if len(digits) > 0 && len(digits) < 19 {
+		var n int64
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				n = -1
+				break
+			}
+			n = n*10 + int64(c-'0')
+		}
+		if n >= 0 {
+			if neg {
+				n = -n
+			}
+			*v = n
+			return true
+		}
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return false
+	}
+	*v = int64(f)
+	return true
+}
+
+// skip passes over any value.
+func (d *fileDecoder) skip() bool {
+	switch d.peek() {
+	case '"':
+		_, _, ok := d.rawString()
+		return ok
+	case '{', '[':
+		depth := 0
+		for d.pos < len(d.data) {
+			switch d.data[d.pos] {
+			case '"':
+				if _, _, ok := d.rawString(); !ok {
+					return false
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			d.pos++
+			if depth == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	start := d.pos
+	for d.pos < len(d.data) && bytes.IndexByte([]byte(",}] \t\r\n"), d.data[d.pos]) < 0 {
+		d.pos++
+	}
+	return d.pos > start
+}
@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFiles(t *testing.T) {
+	require := require.New(t)
+
+	for tc, expected := range map[string][]File{
+		`null`:  nil,
+		` [ ] `: {},
+		`[{"name":"foo","exists":true,"type":"f","size":42,"mode":33188,` +
+			`"uid":501,"gid":20,"nlink":1,"mtime":1531594843,"ctime":1531594842,` +
+			`"cclock":"c:1531594843:978:9:1","oclock":"c:1531594843:978:9:2",` +
+			`"symlink_target":null,"content.sha1hex":"da39a3ee5e6b4b0d3255bfef95601890afd80709"}]`: {
+			{
+				Name:        "foo",
+				Exists:      true,
+				Type:        "f",
+				Size:        42,
+				Mode:        33188,
+				UID:         501,
+				GID:         20,
+				NLink:       1,
+				MTime:       1531594843,
+				CTime:       1531594842,
+				CClock:      "c:1531594843:978:9:1",
+				OClock:      "c:1531594843:978:9:2",
+				ContentSHA1: "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+			},
+		},
+		"[\n  {\"name\": \"l\\u00e9\\\"s\\\"\", \"type\": \"l\", \"symlink_target\": \"../x\"},\n" +
+			"  {\"name\": \"bar\", \"exists\": false, \"size\": -1.5e1, \"type\": \"q\"}\n]": {
+			{Name: `lé"s"`, Type: "l", SymlinkTarget: "../x"},
+			{Name: "bar", Size: -15, Type: "q"},
+		},
+		`[{"name":"dir","type":"d","content.sha1hex":null},` +
+			`{"name":"unreadable","content.sha1hex":{"error":"[\"x\"]: {denied}"}}]`: {
+			{Name: "dir", Type: "d"},
+			{Name: "unreadable"},
+		},
+	} {
+		actual, ok := decodeFiles([]byte(tc))
+		require.True(ok, tc)
+		require.Equal(expected, actual, tc)
+	}
+
+	for _, tc := range []string{
+		`["foo","bar"]`,
+		`[{"name":"foo","new":true}]`,
+		`[{"name":"foo","exists":"yes"}]`,
+		`{"name":"foo"}`,
+		`[{"name":"foo"}`,
+		`[{"name":"foo"}]]`,
+	} {
+		_, ok := decodeFiles([]byte(tc))
+		require.False(ok, tc)
+	}
+}
+
+func TestTypedFiles(t *testing.T) {
+	require := require.New(t)
+
+	for _, x := range []interface{}{
+		json.RawMessage(`[{"name":"foo","exists":true,"new":true,"size":1}]`),
+		[]interface{}{
+			map[string]interface{}{
+				"name": "foo", "exists": true, "new": true, "size": float64(1),
+			},
+		},
+	} {
+		require.Equal([]File{
+			{Name: "foo", Exists: true, Size: 1},
+		}, typedFiles(x))
+	}
+	require.Equal([]File{}, typedFiles(json.RawMessage(`["foo"]`)))
+	require.Equal([]File{}, typedFiles(nil))
+}
+
+// notification returns a subscription PDU for n files, using the fields
+// requested by default.
+func notification(n int) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(`{"unilateral":true,"subscription":"sub1","root":"/tmp",` +
+		`"clock":"c:1531594843:978:9:100001","is_fresh_instance":false,` +
+		`"version":"4.9.0","files":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, `{"cclock":"c:1531594843:978:9:%d","ctime":1531594843,`+
+			`"exists":true,"gid":20,"mode":33188,"mtime":1531594843,`+
+			`"name":"src/pkg%d/file%d.go","nlink":1,`+
+			`"oclock":"c:1531594843:978:9:100000","size":%d,`+
+			`"symlink_target":null,"type":"f","uid":501}`,
+			i, i/100, i, i*10,
+		)
+	}
+	b.WriteString("]}\n")
+	return b.Bytes()
+}
+
+func BenchmarkSubscriptionFiles(b *testing.B) {
+	line := notification(100000)
+
+	b.Run("maps", func(b *testing.B) {
+		b.SetBytes(int64(len(line)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var pdu ResponsePDU
+			if err := json.Unmarshal(line, &pdu); err != nil {
+				b.Fatal(err)
+			}
+			for _, m := range NewSubscription(pdu).Files() {
+				_ = newFile(m)
+			}
+		}
+	})
+
+	b.Run("structs", func(b *testing.B) {
+		b.SetBytes(int64(len(line)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			pdu, err := decodePDURawFiles(line)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if files := NewSubscription(pdu).TypedFiles(); len(files) != 100000 {
+				b.Fatal(len(files))
+			}
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package protocol
+
+/*
+$ watchman get-config /path/to/dir
+{
+  "version": "4.9.0",
+  "config": {
+    "ignore_dirs": ["node_modules"],
+    "settle": 200
+  }
+}
+*/
+
+// A GetConfigRequest represents the Watchman get-config command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/get-config.html
+type GetConfigRequest struct {
+	Path string
+}
+
+// Args returns values used to encode a request PDU.
+func (req *GetConfigRequest) Args() []interface{} {
+	return []interface{}{"get-config", req.Path}
+}
+
+// A GetConfigResponse represents a response to the Watchman get-config command.
+type GetConfigResponse struct {
+	response
+	config map[string]interface{}
+}
+
+// NewGetConfigResponse converts a ResponsePDU to GetConfigResponse
+func NewGetConfigResponse(pdu ResponsePDU) (res *GetConfigResponse) {
+	res = &GetConfigResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["config"]; ok {
+		if config, ok := x.(map[string]interface{}); ok {
+			res.config = config
+		}
+	}
+	return
+}
+
+// Config returns the settings read from the .watchmanconfig file of
+// the watched root.
+func (res *GetConfigResponse) Config() map[string]interface{} {
+	return res.config
+}
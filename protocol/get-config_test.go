@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfig(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      *GetConfigRequest
+		res      *GetConfigResponse
+	}{
+		{
+			request: `["get-config","/tmp"]` + "\n",
+			response: `{"version":"4.9.0","config":` +
+				`{"ignore_dirs":["node_modules"],"settle":200}}` + "\n",
+			req: &GetConfigRequest{Path: "/tmp"},
+			res: &GetConfigResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+						"config": map[string]interface{}{
+							"ignore_dirs": []interface{}{"node_modules"},
+							"settle":      float64(200),
+						},
+					},
+					version: "4.9.0",
+				},
+				config: map[string]interface{}{
+					"ignore_dirs": []interface{}{"node_modules"},
+					"settle":      float64(200),
+				},
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, err := c.Recv()
+		require.NoError(err)
+		require.NotNil(pdu)
+		actual := NewGetConfigResponse(pdu)
+		require.Equal(tc.res, actual)
+		require.Equal("", actual.Warning())
+		require.Equal("4.9.0", actual.Version())
+		require.Equal(tc.res.config, actual.Config())
+	}
+}
@@ -0,0 +1,40 @@
+package protocol
+
+/*
+$ watchman get-pid
+{"version":"4.9.0","pid":12345}
+*/
+
+// A GetPIDRequest represents the Watchman get-pid command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/get-pid.html
+type GetPIDRequest struct{}
+
+// Args returns values used to encode a request PDU.
+func (req *GetPIDRequest) Args() []interface{} {
+	return []interface{}{"get-pid"}
+}
+
+// A GetPIDResponse represents a response to the Watchman get-pid command.
+type GetPIDResponse struct {
+	response
+	pid int
+}
+
+// NewGetPIDResponse converts a ResponsePDU to GetPIDResponse
+func NewGetPIDResponse(pdu ResponsePDU) (res *GetPIDResponse) {
+	res = &GetPIDResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["pid"]; ok {
+		if pid, ok := x.(float64); ok {
+			res.pid = int(pid)
+		}
+	}
+	return
+}
+
+// PID returns the process ID of the Watchman server.
+func (res *GetPIDResponse) PID() int {
+	return res.pid
+}
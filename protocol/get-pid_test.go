@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPID(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      *GetPIDRequest
+		res      *GetPIDResponse
+	}{
+		{
+			request:  `["get-pid"]` + "\n",
+			response: `{"version":"4.9.0","pid":12345}` + "\n",
+			req:      &GetPIDRequest{},
+			res: &GetPIDResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+						"pid":     float64(12345),
+					},
+					version: "4.9.0",
+				},
+				pid: 12345,
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, err := c.Recv()
+		require.NoError(err)
+		require.NotNil(pdu)
+		actual := NewGetPIDResponse(pdu)
+		require.Equal(tc.res, actual)
+		require.Equal("", actual.Warning())
+		require.Equal("4.9.0", actual.Version())
+		require.Equal(12345, actual.PID())
+	}
+}
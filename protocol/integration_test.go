@@ -11,21 +11,34 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/sjansen/watchman/protocol"
+	"github.com/sjansen/watchman/server"
 )
 
 const subName = "TANSTAAFL"
 
+// startServer launches a private Watchman server, so that tests do not
+// share the global server with each other or the current user.
+func startServer(t *testing.T) *server.Server {
+	srv, err := server.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+	return srv
+}
+
 func TestSendAndRecv(t *testing.T) {
 	require := require.New(t)
 
 	// connect
-	c, err := protocol.Connect()
+	srv := startServer(t)
+	c, err := protocol.Connect(protocol.WithSockName(srv.SockName()))
 	require.NoError(err)
 	require.NotEmpty(c.Version())
 
 	// sockname
 	sockname := c.SockName()
-	require.NotEmpty(sockname)
+	require.Equal(srv.SockName(), sockname)
 
 	// capabilities
 	require.Equal(true, c.HasCapability("cmd-watch-project"))
@@ -59,6 +72,46 @@ func TestSendAndRecv(t *testing.T) {
 	watchList := protocol.NewWatchListResponse(pdu)
 	require.NotEmpty(watchList.Roots())
 
+	// get-config
+	err = c.Send(&protocol.GetConfigRequest{Path: watchRoot})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	getConfig := protocol.NewGetConfigResponse(pdu)
+	require.NotNil(getConfig.Config())
+
+	// get-pid
+	err = c.Send(&protocol.GetPIDRequest{})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	getPID := protocol.NewGetPIDResponse(pdu)
+	require.NotZero(getPID.PID())
+
+	// log
+	err = c.Send(&protocol.LogRequest{Level: "debug", Message: subName})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	log := protocol.NewLogResponse(pdu)
+	require.True(log.Logged())
+
+	// log-level
+	err = c.Send(&protocol.LogLevelRequest{Level: "off"})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	logLevel := protocol.NewLogLevelResponse(pdu)
+	require.Equal("off", logLevel.LogLevel())
+
 	// clock
 	for _, req := range []*protocol.ClockRequest{
 		{
@@ -79,6 +132,17 @@ func TestSendAndRecv(t *testing.T) {
 		require.NotEmpty(clock.Clock())
 	}
 
+	// query
+	err = c.Send(&protocol.QueryRequest{Root: watchRoot})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	query := protocol.NewQueryResponse(pdu)
+	require.NotEmpty(query.Clock())
+	require.NotEmpty(query.Files())
+
 	// subscribe
 	err = c.Send(&protocol.SubscribeRequest{
 		Root: testdata,
@@ -121,6 +185,16 @@ func TestSendAndRecv(t *testing.T) {
 	require.NotEmpty(pdu["clock"])
 	require.NotEmpty(pdu["files"])
 
+	// shutdown-server
+	err = c.Send(&protocol.ShutdownServerRequest{})
+	require.NoError(err)
+
+	pdu, err = c.Recv()
+	require.NoError(err)
+	require.NotNil(pdu)
+	shutdown := protocol.NewShutdownServerResponse(pdu)
+	require.True(shutdown.ShutdownServer())
+
 	err = c.Close()
 	require.NoError(err)
 }
@@ -131,16 +205,11 @@ func (req *NoopRequest) Args() []interface{} {
 	return []interface{}{"noop"}
 }
 
-type VersionRequest struct{}
-
-func (req *VersionRequest) Args() []interface{} {
-	return []interface{}{"version"}
-}
-
 func TestInvalidCommand(t *testing.T) {
 	require := require.New(t)
 
-	c, err := protocol.Connect()
+	srv := startServer(t)
+	c, err := protocol.Connect(protocol.WithSockName(srv.SockName()))
 	require.NoError(err)
 	require.NotEmpty(c.Version())
 
@@ -155,7 +224,7 @@ func TestInvalidCommand(t *testing.T) {
 	require.NotEmpty(err.Error())
 
 	// connection should still be valid
-	err = c.Send(&VersionRequest{})
+	err = c.Send(&protocol.VersionRequest{})
 	require.NoError(err)
 
 	pdu, err = c.Recv()
@@ -165,3 +234,30 @@ func TestInvalidCommand(t *testing.T) {
 	err = c.Close()
 	require.NoError(err)
 }
+
+func TestCapabilityNegotiation(t *testing.T) {
+	require := require.New(t)
+
+	srv := startServer(t)
+	c, err := protocol.Connect(
+		protocol.WithSockName(srv.SockName()),
+		protocol.WithRequiredCapabilities("cmd-watch-project"),
+		protocol.WithOptionalCapabilities("fire-the-missles"),
+	)
+	require.NoError(err)
+	require.Equal(true, c.HasCapability("cmd-watch-project"))
+	require.Equal(false, c.HasCapability("fire-the-missles"))
+
+	err = c.Close()
+	require.NoError(err)
+
+	c, err = protocol.Connect(
+		protocol.WithSockName(srv.SockName()),
+		protocol.WithRequiredCapabilities("cmd-watch-project", "fire-the-missles"),
+	)
+	require.Nil(c)
+	require.Equal(
+		&protocol.CapabilityError{Missing: []string{"fire-the-missles"}},
+		err,
+	)
+}
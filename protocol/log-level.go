@@ -0,0 +1,79 @@
+package protocol
+
+/*
+["log-level", "debug"]
+{"log_level":"debug","version":"4.9.0"}
+{"unilateral":true,"level":"debug","log":"1531594843: client=0x7f8b4c: hello\n","version":"4.9.0"}
+*/
+
+// A LogLevelRequest represents the Watchman log-level command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/log-level.html
+type LogLevelRequest struct {
+	Level string
+}
+
+// Args returns values used to encode a request PDU.
+func (req *LogLevelRequest) Args() []interface{} {
+	return []interface{}{"log-level", req.Level}
+}
+
+// A LogLevelResponse represents a response to the Watchman log-level command.
+type LogLevelResponse struct {
+	response
+	logLevel string
+}
+
+// NewLogLevelResponse converts a ResponsePDU to LogLevelResponse
+func NewLogLevelResponse(pdu ResponsePDU) (res *LogLevelResponse) {
+	res = &LogLevelResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["log_level"]; ok {
+		if logLevel, ok := x.(string); ok {
+			res.logLevel = logLevel
+		}
+	}
+	return
+}
+
+// LogLevel returns the log level now in effect for the connection.
+func (res *LogLevelResponse) LogLevel() string {
+	return res.logLevel
+}
+
+// A Log represents a server log message sent as a result of the
+// Watchman log-level command.
+type Log struct {
+	response
+	level string
+	log   string
+}
+
+// NewLog converts a ResponsePDU to Log
+func NewLog(pdu ResponsePDU) (l *Log) {
+	l = &Log{}
+	l.response.init(pdu)
+
+	if x, ok := pdu["level"]; ok {
+		if level, ok := x.(string); ok {
+			l.level = level
+		}
+	}
+	if x, ok := pdu["log"]; ok {
+		if log, ok := x.(string); ok {
+			l.log = log
+		}
+	}
+	return
+}
+
+// Level returns the severity of the message, if reported by the server.
+func (l *Log) Level() string {
+	return l.level
+}
+
+// Log returns the text of the message.
+func (l *Log) Log() string {
+	return l.log
+}
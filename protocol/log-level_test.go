@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevel(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      *LogLevelRequest
+		res      *LogLevelResponse
+	}{
+		{
+			request:  `["log-level","debug"]` + "\n",
+			response: `{"log_level":"debug","version":"4.9.0"}` + "\n",
+			req:      &LogLevelRequest{Level: "debug"},
+			res: &LogLevelResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version":   "4.9.0",
+						"log_level": "debug",
+					},
+					version: "4.9.0",
+				},
+				logLevel: "debug",
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, err := c.Recv()
+		require.NoError(err)
+		require.NotNil(pdu)
+		actual := NewLogLevelResponse(pdu)
+		require.Equal(tc.res, actual)
+		require.Equal("", actual.Warning())
+		require.Equal("4.9.0", actual.Version())
+		require.Equal("debug", actual.LogLevel())
+	}
+}
+
+func TestNewLog(t *testing.T) {
+	require := require.New(t)
+
+	pdu := ResponsePDU{
+		"unilateral": true,
+		"level":      "debug",
+		"log":        "1531594843: hello\n",
+		"version":    "4.9.0",
+	}
+	require.True(pdu.IsLog())
+
+	actual := NewLog(pdu)
+	require.Equal(&Log{
+		response: response{
+			pdu:     pdu,
+			version: "4.9.0",
+		},
+		level: "debug",
+		log:   "1531594843: hello\n",
+	}, actual)
+	require.Equal("debug", actual.Level())
+	require.Equal("1531594843: hello\n", actual.Log())
+}
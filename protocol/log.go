@@ -0,0 +1,43 @@
+package protocol
+
+/*
+["log", "debug", "hello, world"]
+{"logged":true,"version":"4.9.0"}
+*/
+
+// A LogRequest represents the Watchman log command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/log.html
+type LogRequest struct {
+	Level   string
+	Message string
+}
+
+// Args returns values used to encode a request PDU.
+func (req *LogRequest) Args() []interface{} {
+	return []interface{}{"log", req.Level, req.Message}
+}
+
+// A LogResponse represents a response to the Watchman log command.
+type LogResponse struct {
+	response
+	logged bool
+}
+
+// NewLogResponse converts a ResponsePDU to LogResponse
+func NewLogResponse(pdu ResponsePDU) (res *LogResponse) {
+	res = &LogResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["logged"]; ok {
+		if logged, ok := x.(bool); ok {
+			res.logged = logged
+		}
+	}
+	return
+}
+
+// Logged indicates if the message was written to the server log.
+func (res *LogResponse) Logged() bool {
+	return res.logged
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"context"
+	"log/slog"
+)
+
+// maxLoggedPDU limits how much of each PDU is included in debug logs.
+const maxLoggedPDU = 512
+
+// discardHandler is used when no slog.Handler is configured.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// NewLogger returns a Logger using h, or one that discards every record
+// if h is nil.
+func NewLogger(h slog.Handler) *slog.Logger {
+	if h == nil {
+		return discardLogger
+	}
+	return slog.New(h)
+}
+
+// log returns the Logger of the connection, which is nil for zero
+// value Connections.
+func (c *Connection) log() *slog.Logger {
+	if c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// logPDU logs an encoded PDU at debug level, truncated to maxLoggedPDU
+// bytes.
+func logPDU(logger *slog.Logger, msg string, b []byte) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	pdu := b
+	if len(pdu) > maxLoggedPDU {
+		pdu = pdu[:maxLoggedPDU]
+	}
+	logger.Debug(msg,
+		slog.Int("size", len(b)),
+		slog.Bool("truncated", len(b) > maxLoggedPDU),
+		slog.String("pdu", string(pdu)),
+	)
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging(t *testing.T) {
+	require := require.New(t)
+
+	logged := &bytes.Buffer{}
+	c := &Connection{
+		logger: slog.New(slog.NewTextHandler(logged, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		})),
+		reader: bufio.NewReader(strings.NewReader(
+			`{"version":"4.9.0"}` + "\n" + "{invalid\n",
+		)),
+		socket: &bytes.Buffer{},
+	}
+
+	err := c.Send(RawRequest{"log", "debug", strings.Repeat("x", 1000)})
+	require.NoError(err)
+	_, err = c.Recv()
+	require.NoError(err)
+	_, err = c.Recv()
+	require.Error(err)
+
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	require.Len(lines, 4)
+	require.Contains(lines[0], `msg="sending PDU" size=1018 truncated=true`)
+	require.Contains(lines[1], `msg="received PDU" size=19 truncated=false`)
+	require.Contains(lines[2], `msg="received PDU" size=8 truncated=false pdu={invalid`)
+	require.Contains(lines[3], `level=ERROR msg="unable to decode PDU"`)
+
+	logged.Reset()
+	require.NoError(c.Close())
+	require.NoError(c.Close())
+	require.Equal(1, strings.Count(logged.String(), "disconnecting"))
+	require.Contains(logged.String(), `level=INFO msg=disconnecting`)
+}
+
+func TestLoggingDisabled(t *testing.T) {
+	require := require.New(t)
+
+	c := &Connection{socket: &bytes.Buffer{}}
+	require.NoError(c.Send(RawRequest{"version"}))
+	require.Same(discardLogger, NewLogger(nil))
+}
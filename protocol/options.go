@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// A Dialer opens a connection to the Watchman server listening at sockname.
+type Dialer func(sockname string, timeout time.Duration) (net.Conn, error)
+
+// An Option configures how Connect establishes a Connection.
+type Option func(*options)
+
+type options struct {
+	binary      string
+	dialer      Dialer
+	dialTimeout time.Duration
+	env         []string
+	logHandler  slog.Handler
+	optional    []string
+	required    []string
+	sockname    string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		binary:      "watchman",
+		dialer:      dial,
+		dialTimeout: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) getenv(key string) string {
+	if o.env == nil {
+		return os.Getenv(key)
+	}
+	prefix := key + "="
+	for i := len(o.env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(o.env[i], prefix) {
+			return o.env[i][len(prefix):]
+		}
+	}
+	return ""
+}
+
+// WithBinary sets the path of the watchman executable used to locate,
+// and if necessary start, the Watchman server. By default, "watchman"
+// is found using PATH.
+func WithBinary(path string) Option {
+	return func(o *options) {
+		o.binary = path
+	}
+}
+
+// WithDialer replaces the function used to open the connection to the
+// Watchman server.
+func WithDialer(dialer Dialer) Option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithDialTimeout limits how long Connect waits for the connection to
+// the Watchman server to open. The default is 30 seconds.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithLogHandler enables diagnostic logging. Connecting and disconnecting
+// are logged at info level, decode errors at error level, and every PDU
+// sent or received at debug level. By default, nothing is logged.
+func WithLogHandler(h slog.Handler) Option {
+	return func(o *options) {
+		o.logHandler = h
+	}
+}
+
+// WithEnv replaces the environment, in the form "key=value", used to
+// read WATCHMAN_SOCK and to run the watchman executable. By default,
+// the environment of the current process is used.
+func WithEnv(env []string) Option {
+	return func(o *options) {
+		o.env = env
+	}
+}
+
+// WithOptionalCapabilities asks the Watchman server which of the listed
+// capabilities it supports, without failing if some are missing.
+func WithOptionalCapabilities(capabilities ...string) Option {
+	return func(o *options) {
+		o.optional = append(o.optional, capabilities...)
+	}
+}
+
+// WithRequiredCapabilities causes Connect to fail with a CapabilityError
+// unless the Watchman server supports every listed capability.
+func WithRequiredCapabilities(capabilities ...string) Option {
+	return func(o *options) {
+		o.required = append(o.required, capabilities...)
+	}
+}
+
+// WithSockName sets the location of the socket used to communicate with
+// the Watchman server, skipping WATCHMAN_SOCK and `watchman get-sockname`.
+func WithSockName(sockname string) Option {
+	return func(o *options) {
+		o.sockname = sockname
+	}
+}
@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSockName(t *testing.T) {
+	require := require.New(t)
+
+	o := newOptions([]Option{
+		WithEnv([]string{"WATCHMAN_SOCK=/tmp/env.sock"}),
+		WithSockName("/tmp/explicit.sock"),
+	})
+	actual, err := sockname(o)
+	require.NoError(err)
+	require.Equal("/tmp/explicit.sock", actual)
+
+	o = newOptions([]Option{
+		WithEnv([]string{
+			"WATCHMAN_SOCK=/tmp/old.sock",
+			"WATCHMAN_SOCK=/tmp/env.sock",
+		}),
+	})
+	actual, err = sockname(o)
+	require.NoError(err)
+	require.Equal("/tmp/env.sock", actual)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	binary := filepath.Join(t.TempDir(), "watchman")
+	script := "#!/bin/sh\necho '{\"sockname\":\"/tmp/binary.sock\"}'\n"
+	err = os.WriteFile(binary, []byte(script), 0o755)
+	require.NoError(err)
+
+	o = newOptions([]Option{
+		WithBinary(binary),
+		WithEnv([]string{}),
+	})
+	actual, err = sockname(o)
+	require.NoError(err)
+	require.Equal("/tmp/binary.sock", actual)
+}
+
+func TestConnectWithDialer(t *testing.T) {
+	require := require.New(t)
+
+	var requested struct {
+		sockname string
+		timeout  time.Duration
+	}
+	dialer := func(sockname string, timeout time.Duration) (net.Conn, error) {
+		requested.sockname = sockname
+		requested.timeout = timeout
+
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			r := bufio.NewReader(server)
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return
+			}
+			server.Write([]byte(
+				`{"version":"4.9.0","capabilities":["cmd-clock"]}` + "\n",
+			))
+		}()
+		return client, nil
+	}
+
+	c, err := Connect(
+		WithDialer(dialer),
+		WithDialTimeout(time.Second),
+		WithSockName("/tmp/test.sock"),
+	)
+	require.NoError(err)
+	require.Equal("/tmp/test.sock", requested.sockname)
+	require.Equal(time.Second, requested.timeout)
+	require.Equal("/tmp/test.sock", c.SockName())
+	require.Equal("4.9.0", c.Version())
+	require.True(c.HasCapability("cmd-clock"))
+	require.NoError(c.Close())
+
+	expected := errors.New("connection refused")
+	c, err = Connect(
+		WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return nil, expected
+		}),
+		WithSockName("/tmp/test.sock"),
+	)
+	require.Nil(c)
+	require.Equal(expected, err)
+}
@@ -1,10 +1,24 @@
 package protocol
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 // Request is the interface used to encode a request PDU.
 type Request interface {
 	Args() []interface{}
 }
 
+// CapabilityRequirer is implemented by requests that depend on optional
+// Watchman features. It lists the capabilities the server must support
+// for the request to succeed.
+//
+// See also: https://facebook.github.io/watchman/docs/capabilities.html
+type CapabilityRequirer interface {
+	RequiredCapabilities() []string
+}
+
 // Response is the interface common to all response PDUs.
 type Response interface {
 	PDU() ResponsePDU
@@ -48,9 +62,59 @@ func (r *response) Warning() string {
 	return r.warning
 }
 
-// ResponsePDU provides access to response data decoded to primitive Go values.
+// ResponsePDU provides access to response data decoded to primitive Go
+// values.
 type ResponsePDU map[string]interface{}
 
+var errInvalidPDU = errors.New("invalid PDU: expected a single JSON object")
+
+func decodePDU(b []byte) (pdu ResponsePDU, err error) {
+	err = json.Unmarshal(b, &pdu)
+	return
+}
+
+// decodePDURawFiles decodes every value of a PDU except "files", which
+// is left encoded as a json.RawMessage. The RawMessage is a sub-slice of
+// b, so b must not be modified afterwards.
+func decodePDURawFiles(b []byte) (pdu ResponsePDU, err error) {
+	start, end, ok := findFiles(b)
+	if !ok {
+		return decodePDU(b)
+	}
+	if !json.Valid(b[start:end]) {
+		return nil, errInvalidPDU
+	}
+
+	// decode everything else, with "files" replaced by null
+	rest := make([]byte, 0, len(b)-(end-start)+len("null"))
+	rest = append(rest, b[:start]...)
+	rest = append(rest, "null"...)
+	rest = append(rest, b[end:]...)
+	if err = json.Unmarshal(rest, &pdu); err != nil {
+		return nil, err
+	}
+	pdu["files"] = json.RawMessage(b[start:end])
+	return pdu, nil
+}
+
+// ExpandFiles decodes "files" left encoded by RecvRawFiles, so that pdu
+// has the same shape as a ResponsePDU returned by Recv.
+func (pdu ResponsePDU) ExpandFiles() {
+	if raw, ok := pdu["files"].(json.RawMessage); ok {
+		var files interface{}
+		if err := json.Unmarshal(raw, &files); err == nil {
+			pdu["files"] = files
+		}
+	}
+}
+
+// IsLog indicates if the ResponsePDU is a server log message sent
+// as a result of the log-level command.
+func (pdu ResponsePDU) IsLog() bool {
+	_, ok := pdu["log"]
+	return ok && pdu.IsUnilateral()
+}
+
 // IsUnilateral indicates if the ResponsePDU was sent in response to
 // the immediately previous request, or an older request such as the
 // subscribe command.
@@ -3,6 +3,7 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -67,3 +68,54 @@ func TestResponseMixin(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodePDU(t *testing.T) {
+	require := require.New(t)
+
+	b := []byte(
+		`{"clock":"c:1531594843:978:9:1","files":[{"name":"foo"}],` +
+			`"is_fresh_instance":true,"version":"4.9.0"}` + "\n",
+	)
+	expected := ResponsePDU{
+		"clock":             "c:1531594843:978:9:1",
+		"files":             []interface{}{map[string]interface{}{"name": "foo"}},
+		"is_fresh_instance": true,
+		"version":           "4.9.0",
+	}
+
+	pdu, err := decodePDU(b)
+	require.NoError(err)
+	require.Equal(expected, pdu)
+
+	pdu, err = decodePDURawFiles(b)
+	require.NoError(err)
+	require.Equal(json.RawMessage(`[{"name":"foo"}]`), pdu["files"])
+	pdu.ExpandFiles()
+	require.Equal(expected, pdu)
+
+	// only the top-level "files" is left encoded
+	pdu, err = decodePDURawFiles([]byte(
+		`{"metadata":{"files":[1]},"w\"x":"\"files\"",` +
+			` "files" : [{"name":"a\"]}"}] ,"n":-1.5e3}`,
+	))
+	require.NoError(err)
+	require.Equal(ResponsePDU{
+		"metadata": map[string]interface{}{"files": []interface{}{float64(1)}},
+		"w\"x":     `"files"`,
+		"files":    json.RawMessage(`[{"name":"a\"]}"}]`),
+		"n":        float64(-1500),
+	}, pdu)
+
+	for _, tc := range []string{
+		`["not","a","pdu"]`,
+		`{"version":"4.9.0"`,
+		`{"version":"4.9.0"}{}`,
+		`{"files":[{"name":"foo"}}`,
+		`{"files":[],"version":}`,
+	} {
+		_, err = decodePDU([]byte(tc))
+		require.Error(err, tc)
+		_, err = decodePDURawFiles([]byte(tc))
+		require.Error(err, tc)
+	}
+}
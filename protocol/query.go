@@ -0,0 +1,300 @@
+package protocol
+
+/*
+["query", "/tmp", {"since": "c:1531594843:978:9:826", "fields": ["name", "exists"]}]
+{"clock":"c:1531594843:978:9:830",
+ "is_fresh_instance":false,
+ "files":[{
+  "exists": true,
+  "name": "foo/main.go"
+ }],
+ "version":"4.9.0"}
+
+["query", "/tmp", {"since": {"scm": {"mergebase-with": "main"}}, "fields": ["name"]}]
+{"clock":{
+  "clock": "c:1531594843:978:9:831",
+  "scm": {"mergebase": "f0e8a2c1", "mergebase-with": "main"}
+ },
+ "is_fresh_instance":true,
+ "files":[{"name": "foo/main.go"}],
+ "version":"4.9.0"}
+*/
+
+var defaultFields = []string{
+	"cclock", "ctime", "exists", "gid", "mode", "mtime", "name",
+	"nlink", "oclock", "size", "symlink_target", "type", "uid",
+}
+
+// DefaultFields returns the file attributes requested when Query.Fields
+// is empty.
+func DefaultFields() []string {
+	return append([]string(nil), defaultFields...)
+}
+
+// A Query represents the query specification used by the Watchman
+// query and subscribe commands.
+//
+// See also: https://facebook.github.io/watchman/docs/file-query.html
+type Query struct {
+	// Fields lists the file attributes to return. If empty, every
+	// attribute used by package watchman is requested.
+	Fields []string
+	// Since limits results to files changed after a clock value.
+	Since string
+	// MergeBaseWith makes the query SCM-aware. Results are limited to
+	// files changed since the merge base of the working copy and the
+	// named revision, such as "main". If Since is also set, results are
+	// relative to Since unless the merge base has changed.
+	MergeBaseWith string
+
+	// Generators select the files considered by a query. If none are
+	// set, Since is used, or every file if Since is also empty.
+
+	// Glob lists wildmatch patterns relative to the root.
+	Glob []string
+	// GlobIncludeDotFiles allows Glob wildcards to match names starting
+	// with a period.
+	GlobIncludeDotFiles bool
+	// Path lists directories and files relative to the root.
+	Path []PathGenerator
+	// Suffix lists file name extensions, without a leading period.
+	Suffix []string
+
+	// RelativeRoot limits results to a subdirectory of the root. File
+	// names in results are relative to the subdirectory.
+	RelativeRoot string
+
+	// Expression filters the files selected by generators, for example
+	// []interface{}{"suffix", "go"}.
+	//
+	// See also: https://facebook.github.io/watchman/docs/expr/allof.html
+	Expression []interface{}
+}
+
+// A PathGenerator selects a file, or the contents of a directory up to
+// Depth levels deep. A Depth of 0 selects only the direct children of a
+// directory. A negative Depth is unlimited.
+type PathGenerator struct {
+	Name  string
+	Depth int
+}
+
+func (q *Query) args() map[string]interface{} {
+	m := map[string]interface{}{}
+	if len(q.Fields) > 0 {
+		m["fields"] = q.Fields
+	} else {
+		m["fields"] = defaultFields
+	}
+	if len(q.Glob) > 0 {
+		m["glob"] = q.Glob
+		if q.GlobIncludeDotFiles {
+			m["glob_includedotfiles"] = true
+		}
+	}
+	if len(q.Path) > 0 {
+		paths := make([]interface{}, len(q.Path))
+		for i, p := range q.Path {
+			if p.Depth < 0 {
+				paths[i] = p.Name
+			} else {
+				paths[i] = map[string]interface{}{
+					"path":  p.Name,
+					"depth": p.Depth,
+				}
+			}
+		}
+		m["path"] = paths
+	}
+	if len(q.Suffix) > 0 {
+		m["suffix"] = q.Suffix
+	}
+	if q.RelativeRoot != "" {
+		m["relative_root"] = q.RelativeRoot
+	}
+	if len(q.Expression) > 0 {
+		m["expression"] = q.Expression
+	}
+	if q.MergeBaseWith != "" {
+		since := map[string]interface{}{
+			"scm": map[string]string{"mergebase-with": q.MergeBaseWith},
+		}
+		if q.Since != "" {
+			since["clock"] = q.Since
+		}
+		m["since"] = since
+	} else if q.Since != "" {
+		m["since"] = q.Since
+	}
+	return m
+}
+
+func (q *Query) capabilities() (capabilities []string) {
+	for _, field := range q.Fields {
+		if field == "content.sha1hex" {
+			capabilities = append(capabilities, "field-content.sha1hex")
+		}
+	}
+	if len(q.Glob) > 0 {
+		capabilities = append(capabilities, "glob_generator")
+	}
+	if q.RelativeRoot != "" {
+		capabilities = append(capabilities, "relative_root")
+	}
+	if q.MergeBaseWith != "" {
+		capabilities = append(capabilities, "scm-since")
+	}
+	if len(q.Expression) > 0 {
+		capabilities = termCapabilities(capabilities, q.Expression)
+	}
+	return
+}
+
+// termCapabilities appends the capabilities needed by each term of an
+// expression, such as term-match, to capabilities.
+//
+// See also: https://facebook.github.io/watchman/docs/expr/allof.html
+func termCapabilities(capabilities []string, expr interface{}) []string {
+	var term []interface{}
+	switch x := expr.(type) {
+	case string:
+		term = []interface{}{x}
+	case []interface{}:
+		term = x
+	default:
+		return capabilities
+	}
+	if len(term) < 1 {
+		return capabilities
+	}
+	name, ok := term[0].(string)
+	if !ok {
+		return capabilities
+	}
+
+	capabilities = appendOnce(capabilities, "term-"+name)
+	switch name {
+	case "allof", "anyof", "not":
+		for _, operand := range term[1:] {
+			capabilities = termCapabilities(capabilities, operand)
+		}
+	case "suffix":
+		if len(term) > 1 {
+			switch term[1].(type) {
+			case []interface{}, []string:
+				capabilities = appendOnce(capabilities, "suffix-set")
+			}
+		}
+	}
+	return capabilities
+}
+
+func appendOnce(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// scm holds the SCM details reported by a "fat" clock.
+type scm struct {
+	mergeBase     string
+	mergeBaseWith string
+}
+
+// parseClock extracts values from either a plain clock string, or a
+// "fat" clock object returned for SCM-aware queries.
+func parseClock(x interface{}) (clock string, s scm) {
+	switch v := x.(type) {
+	case string:
+		clock = v
+	case map[string]interface{}:
+		clock, _ = v["clock"].(string)
+		if x, ok := v["scm"].(map[string]interface{}); ok {
+			s.mergeBase, _ = x["mergebase"].(string)
+			s.mergeBaseWith, _ = x["mergebase-with"].(string)
+		}
+	}
+	return
+}
+
+// MergeBase returns the current merge base, if the query was SCM-aware.
+func (s *scm) MergeBase() string {
+	return s.mergeBase
+}
+
+// MergeBaseWith returns the revision used to find the merge base, if
+// the query was SCM-aware.
+func (s *scm) MergeBaseWith() string {
+	return s.mergeBaseWith
+}
+
+// A QueryRequest represents the Watchman query command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/query.html
+type QueryRequest struct {
+	Root  string
+	Query Query
+}
+
+// Args returns values used to encode a request PDU.
+func (req *QueryRequest) Args() []interface{} {
+	return []interface{}{"query", req.Root, req.Query.args()}
+}
+
+// RequiredCapabilities returns the capabilities needed by the request.
+func (req *QueryRequest) RequiredCapabilities() []string {
+	return req.Query.capabilities()
+}
+
+// A QueryResponse represents a response to the Watchman query command.
+type QueryResponse struct {
+	response
+	scm
+	clock           string
+	files           interface{}
+	isFreshInstance bool
+}
+
+// NewQueryResponse converts a ResponsePDU to QueryResponse
+func NewQueryResponse(pdu ResponsePDU) (res *QueryResponse) {
+	res = &QueryResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["clock"]; ok {
+		res.clock, res.scm = parseClock(x)
+	}
+	res.files = pdu["files"]
+	if x, ok := pdu["is_fresh_instance"]; ok {
+		if isFreshInstance, ok := x.(bool); ok {
+			res.isFreshInstance = isFreshInstance
+		}
+	}
+	return
+}
+
+// Clock returns a value representing when the query was evaluated.
+func (res *QueryResponse) Clock() string {
+	return res.clock
+}
+
+// Files returns the files matching the query, decoded as maps.
+func (res *QueryResponse) Files() []map[string]interface{} {
+	return files(res.files)
+}
+
+// TypedFiles returns the files matching the query. Fields not included
+// in File are ignored. If the response was received using RecvRawFiles,
+// the fields requested by default are decoded without allocating a map
+// for each file.
+func (res *QueryResponse) TypedFiles() []File {
+	return typedFiles(res.files)
+}
+
+// IsFreshInstance indicates if the results include every matching
+// file, instead of only those changed since the requested clock.
+func (res *QueryResponse) IsFreshInstance() bool {
+	return res.isFreshInstance
+}
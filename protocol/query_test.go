@@ -0,0 +1,268 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      *QueryRequest
+		res      *QueryResponse
+		files    []map[string]interface{}
+		typed    []File
+	}{
+		{
+			request: `["query","/tmp",{"fields":[` +
+				`"cclock","ctime","exists","gid","mode","mtime","name",` +
+				`"nlink","oclock","size","symlink_target","type","uid"` +
+				"]}]\n",
+			response: `{"clock":"c:1531594843:978:9:345","is_fresh_instance":true,` +
+				`"files":[{"name":"foo","exists":true}],"version":"4.9.0"}` + "\n",
+			req: &QueryRequest{Root: "/tmp"},
+			res: &QueryResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version":           "4.9.0",
+						"clock":             "c:1531594843:978:9:345",
+						"is_fresh_instance": true,
+						"files": json.RawMessage(
+							`[{"name":"foo","exists":true}]`,
+						),
+					},
+					version: "4.9.0",
+				},
+				clock:           "c:1531594843:978:9:345",
+				isFreshInstance: true,
+				files: json.RawMessage(
+					`[{"name":"foo","exists":true}]`,
+				),
+			},
+			files: []map[string]interface{}{
+				{"name": "foo", "exists": true},
+			},
+			typed: []File{
+				{Name: "foo", Exists: true},
+			},
+		},
+		{
+			request: `["query","/tmp",{"fields":["name","exists"],` +
+				`"since":"c:1531594843:978:9:345"}]` + "\n",
+			response: `{"clock":"c:1531594843:978:9:346","is_fresh_instance":false,` +
+				`"files":[],"version":"4.9.0"}` + "\n",
+			req: &QueryRequest{
+				Root: "/tmp",
+				Query: Query{
+					Fields: []string{"name", "exists"},
+					Since:  "c:1531594843:978:9:345",
+				},
+			},
+			res: &QueryResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version":           "4.9.0",
+						"clock":             "c:1531594843:978:9:346",
+						"is_fresh_instance": false,
+						"files":             json.RawMessage(`[]`),
+					},
+					version: "4.9.0",
+				},
+				clock: "c:1531594843:978:9:346",
+				files: json.RawMessage(`[]`),
+			},
+			files: []map[string]interface{}{},
+			typed: []File{},
+		},
+		{
+			request: `["query","/tmp",{"fields":["name"],"since":{` +
+				`"clock":"c:1531594843:978:9:346",` +
+				`"scm":{"mergebase-with":"main"}}}]` + "\n",
+			response: `{"clock":{"clock":"c:1531594843:978:9:347",` +
+				`"scm":{"mergebase":"f0e8a2c1","mergebase-with":"main"}},` +
+				`"is_fresh_instance":true,` +
+				`"files":[{"name":"foo"}],"version":"4.9.0"}` + "\n",
+			req: &QueryRequest{
+				Root: "/tmp",
+				Query: Query{
+					Fields:        []string{"name"},
+					Since:         "c:1531594843:978:9:346",
+					MergeBaseWith: "main",
+				},
+			},
+			res: &QueryResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+						"clock": map[string]interface{}{
+							"clock": "c:1531594843:978:9:347",
+							"scm": map[string]interface{}{
+								"mergebase":      "f0e8a2c1",
+								"mergebase-with": "main",
+							},
+						},
+						"is_fresh_instance": true,
+						"files":             json.RawMessage(`[{"name":"foo"}]`),
+					},
+					version: "4.9.0",
+				},
+				scm: scm{
+					mergeBase:     "f0e8a2c1",
+					mergeBaseWith: "main",
+				},
+				clock:           "c:1531594843:978:9:347",
+				isFreshInstance: true,
+				files:           json.RawMessage(`[{"name":"foo"}]`),
+			},
+			files: []map[string]interface{}{
+				{"name": "foo"},
+			},
+			typed: []File{
+				{Name: "foo"},
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, _, err := c.RecvRawFiles()
+		require.NoError(err)
+		require.NotNil(pdu)
+		actual := NewQueryResponse(pdu)
+		require.Equal(tc.res, actual)
+		require.Equal("", actual.Warning())
+		require.Equal("4.9.0", actual.Version())
+		require.Equal(tc.res.clock, actual.Clock())
+		require.Equal(tc.files, actual.Files())
+		require.Equal(tc.typed, actual.TypedFiles())
+		require.Equal(tc.res.isFreshInstance, actual.IsFreshInstance())
+		require.Equal(tc.res.mergeBase, actual.MergeBase())
+		require.Equal(tc.res.mergeBaseWith, actual.MergeBaseWith())
+
+		// files decoded by Recv give the same results
+		pdu.ExpandFiles()
+		require.IsType([]interface{}{}, pdu["files"])
+		actual = NewQueryResponse(pdu)
+		require.Equal(tc.files, actual.Files())
+		require.Equal(tc.typed, actual.TypedFiles())
+	}
+}
+
+func TestQueryRequiredCapabilities(t *testing.T) {
+	require := require.New(t)
+
+	req := &QueryRequest{Root: "/tmp"}
+	require.Empty(req.RequiredCapabilities())
+
+	req.Query.MergeBaseWith = "main"
+	require.Equal([]string{"scm-since"}, req.RequiredCapabilities())
+
+	req.Query.Fields = append(DefaultFields(), "content.sha1hex")
+	require.Equal(
+		[]string{"field-content.sha1hex", "scm-since"},
+		req.RequiredCapabilities(),
+	)
+	require.Equal(defaultFields, DefaultFields())
+
+	req.Query = Query{
+		Glob:         []string{"**/*.go"},
+		RelativeRoot: "src",
+	}
+	require.Equal(
+		[]string{"glob_generator", "relative_root"},
+		req.RequiredCapabilities(),
+	)
+
+	req.Query = Query{
+		Expression: []interface{}{"allof",
+			"exists",
+			[]interface{}{"suffix", []interface{}{"c", "h"}},
+			[]interface{}{"not", []interface{}{"anyof",
+				[]interface{}{"imatch", "*.o"},
+				[]interface{}{"suffix", "o"},
+			}},
+		},
+	}
+	require.Equal(
+		[]string{
+			"term-allof", "term-exists", "term-suffix", "suffix-set",
+			"term-not", "term-anyof", "term-imatch",
+		},
+		req.RequiredCapabilities(),
+	)
+}
+
+func TestQueryGenerators(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		query    Query
+		expected string
+	}{
+		{
+			query: Query{
+				Fields:              []string{"name"},
+				Glob:                []string{"**/*.go", "go.mod"},
+				GlobIncludeDotFiles: true,
+			},
+			expected: `["query","/tmp",{"fields":["name"],` +
+				`"glob":["**/*.go","go.mod"],"glob_includedotfiles":true}]` + "\n",
+		},
+		{
+			query: Query{
+				Fields: []string{"name"},
+				Path: []PathGenerator{
+					{Name: "cmd", Depth: 0},
+					{Name: "docs", Depth: -1},
+				},
+				RelativeRoot: "src",
+			},
+			expected: `["query","/tmp",{"fields":["name"],` +
+				`"path":[{"depth":0,"path":"cmd"},"docs"],` +
+				`"relative_root":"src"}]` + "\n",
+		},
+		{
+			query: Query{
+				Fields: []string{"name"},
+				Suffix: []string{"go", "mod"},
+				Since:  "c:1531594843:978:9:345",
+			},
+			expected: `["query","/tmp",{"fields":["name"],` +
+				`"since":"c:1531594843:978:9:345","suffix":["go","mod"]}]` + "\n",
+		},
+		{
+			query: Query{
+				Fields: []string{"name"},
+				Expression: []interface{}{"allof",
+					[]interface{}{"type", "f"},
+					[]interface{}{"not", []interface{}{"dirname", "vendor"}},
+				},
+			},
+			expected: `["query","/tmp",{"expression":["allof",["type","f"],` +
+				`["not",["dirname","vendor"]]],"fields":["name"]}]` + "\n",
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{socket: requested}
+
+		err := c.Send(&QueryRequest{Root: "/tmp", Query: tc.query})
+		require.NoError(err)
+		require.Equal(tc.expected, requested.String())
+	}
+}
@@ -0,0 +1,18 @@
+package protocol
+
+/*
+["log-level", "debug"]
+{"log_level":"debug","version":"4.9.0"}
+*/
+
+// A RawRequest represents an arbitrary Watchman command, encoded exactly
+// as given. It is useful for commands that do not yet have a dedicated
+// Request type.
+//
+// See also: https://facebook.github.io/watchman/docs/socket-interface.html
+type RawRequest []interface{}
+
+// Args returns values used to encode a request PDU.
+func (req RawRequest) Args() []interface{} {
+	return req
+}
@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawRequest(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      RawRequest
+		pdu      ResponsePDU
+	}{
+		{
+			request:  `["log-level","debug"]` + "\n",
+			response: `{"log_level":"debug","version":"4.9.0"}` + "\n",
+			req:      RawRequest{"log-level", "debug"},
+			pdu: ResponsePDU{
+				"log_level": "debug",
+				"version":   "4.9.0",
+			},
+		},
+		{
+			request:  `["clock","/tmp",{"sync_timeout":1234}]` + "\n",
+			response: `{"clock":"c:1531594843:978:9:345","version":"4.9.0"}` + "\n",
+			req: RawRequest{
+				"clock", "/tmp", map[string]int{"sync_timeout": 1234},
+			},
+			pdu: ResponsePDU{
+				"clock":   "c:1531594843:978:9:345",
+				"version": "4.9.0",
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, err := c.Recv()
+		require.NoError(err)
+		require.Equal(tc.pdu, pdu)
+	}
+}
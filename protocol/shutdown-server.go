@@ -0,0 +1,40 @@
+package protocol
+
+/*
+$ watchman shutdown-server
+{"version":"4.9.0","shutdown-server":true}
+*/
+
+// A ShutdownServerRequest represents the Watchman shutdown-server command.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/shutdown-server.html
+type ShutdownServerRequest struct{}
+
+// Args returns values used to encode a request PDU.
+func (req *ShutdownServerRequest) Args() []interface{} {
+	return []interface{}{"shutdown-server"}
+}
+
+// A ShutdownServerResponse represents a response to the Watchman shutdown-server command.
+type ShutdownServerResponse struct {
+	response
+	shutdownServer bool
+}
+
+// NewShutdownServerResponse converts a ResponsePDU to ShutdownServerResponse
+func NewShutdownServerResponse(pdu ResponsePDU) (res *ShutdownServerResponse) {
+	res = &ShutdownServerResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["shutdown-server"]; ok {
+		if shutdownServer, ok := x.(bool); ok {
+			res.shutdownServer = shutdownServer
+		}
+	}
+	return
+}
+
+// ShutdownServer indicates if the server accepted the request to exit.
+func (res *ShutdownServerResponse) ShutdownServer() bool {
+	return res.shutdownServer
+}
@@ -36,23 +36,25 @@ package protocol
 //
 // See also: https://facebook.github.io/watchman/docs/cmd/subscribe.html
 type SubscribeRequest struct {
-	Root string
-	Name string
+	Root  string
+	Name  string
+	Query Query
 }
 
 // Args returns values used to encode a request PDU.
 func (req *SubscribeRequest) Args() []interface{} {
-	m := map[string]interface{}{
-		"fields": []string{
-			"cclock", "ctime", "exists", "gid", "mode", "mtime", "name",
-			"nlink", "oclock", "size", "symlink_target", "type", "uid",
-		}}
-	return []interface{}{"subscribe", req.Root, req.Name, m}
+	return []interface{}{"subscribe", req.Root, req.Name, req.Query.args()}
+}
+
+// RequiredCapabilities returns the capabilities needed by the request.
+func (req *SubscribeRequest) RequiredCapabilities() []string {
+	return req.Query.capabilities()
 }
 
 // A SubscribeResponse represents a response to the Watchman subscribe command.
 type SubscribeResponse struct {
 	response
+	scm
 	clock        string
 	subscription string
 }
@@ -63,9 +65,7 @@ func NewSubscribeResponse(pdu ResponsePDU) (res *SubscribeResponse) {
 	res.response.init(pdu)
 
 	if x, ok := pdu["clock"]; ok {
-		if clock, ok := x.(string); ok {
-			res.clock = clock
-		}
+		res.clock, res.scm = parseClock(x)
 	}
 	if x, ok := pdu["subscribe"]; ok {
 		if subscription, ok := x.(string); ok {
@@ -89,11 +89,17 @@ func (res *SubscribeResponse) Subscription() string {
 // of the Watchman subscribe command.
 type Subscription struct {
 	response
+	scm
 	clock           string
 	root            string
 	subscription    string
-	files           []map[string]interface{}
+	files           interface{}
 	isFreshInstance bool
+	canceled        bool
+	stateEnter      string
+	stateLeave      string
+	abandoned       bool
+	metadata        interface{}
 }
 
 // NewSubscription converts a ResponsePDU to Subscription
@@ -102,20 +108,30 @@ func NewSubscription(pdu ResponsePDU) (s *Subscription) {
 	s.response.init(pdu)
 
 	if x, ok := pdu["clock"]; ok {
-		if clock, ok := x.(string); ok {
-			s.clock = clock
+		s.clock, s.scm = parseClock(x)
+	}
+	s.files = pdu["files"]
+	if x, ok := pdu["canceled"]; ok {
+		if canceled, ok := x.(bool); ok {
+			s.canceled = canceled
+		}
+	}
+	if x, ok := pdu["state-enter"]; ok {
+		if state, ok := x.(string); ok {
+			s.stateEnter = state
 		}
 	}
-	if x, ok := pdu["files"]; ok {
-		if files, ok := x.([]interface{}); ok {
-			s.files = make([]map[string]interface{}, 0, len(files))
-			for _, file := range files {
-				if data, ok := file.(map[string]interface{}); ok {
-					s.files = append(s.files, data)
-				}
-			}
+	if x, ok := pdu["state-leave"]; ok {
+		if state, ok := x.(string); ok {
+			s.stateLeave = state
 		}
 	}
+	if x, ok := pdu["abandoned"]; ok {
+		if abandoned, ok := x.(bool); ok {
+			s.abandoned = abandoned
+		}
+	}
+	s.metadata = pdu["metadata"]
 	if x, ok := pdu["is_fresh_instance"]; ok {
 		if isFreshInstance, ok := x.(bool); ok {
 			s.isFreshInstance = isFreshInstance
@@ -140,9 +156,29 @@ func (s *Subscription) Clock() string {
 	return s.clock
 }
 
-// Files returns a list of of relative filepaths.
+// Files returns the changed files, decoded as maps.
 func (s *Subscription) Files() []map[string]interface{} {
-	return s.files
+	return files(s.files)
+}
+
+// TypedFiles returns the changed files. Fields not included in File are
+// ignored. If the notification was received using RecvRawFiles, the
+// fields requested by default are decoded without allocating a map for
+// each file.
+func (s *Subscription) TypedFiles() []File {
+	return typedFiles(s.files)
+}
+
+// IsAbandoned indicates if the state named by StateLeave was left
+// because the client that entered it disconnected.
+func (s *Subscription) IsAbandoned() bool {
+	return s.abandoned
+}
+
+// IsCanceled indicates if the subscription was canceled by the Watchman
+// server, for example because its root is no longer watched.
+func (s *Subscription) IsCanceled() bool {
+	return s.canceled
 }
 
 // IsFreshInstance indicates if the notification was sent because
@@ -151,6 +187,12 @@ func (s *Subscription) IsFreshInstance() bool {
 	return s.isFreshInstance
 }
 
+// Metadata returns the value passed to the state-enter or state-leave
+// command that generated the notification.
+func (s *Subscription) Metadata() interface{} {
+	return s.metadata
+}
+
 // Root returns the directory registered to the subscription.
 func (s *Subscription) Root() string {
 	return s.root
@@ -160,3 +202,19 @@ func (s *Subscription) Root() string {
 func (s *Subscription) Subscription() string {
 	return s.subscription
 }
+
+// StateEnter returns the name of a state entered using the state-enter
+// command, if the notification was sent because of the state change.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/state-enter.html
+func (s *Subscription) StateEnter() string {
+	return s.stateEnter
+}
+
+// StateLeave returns the name of a state left using the state-leave
+// command, if the notification was sent because of the state change.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/state-leave.html
+func (s *Subscription) StateLeave() string {
+	return s.stateLeave
+}
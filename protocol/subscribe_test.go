@@ -3,6 +3,7 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -40,6 +41,43 @@ func TestSubscribe(t *testing.T) {
 				subscription: "sub1",
 			},
 		},
+		{
+			request: `["subscribe","/tmp","sub1",{"fields":["name","exists"],` +
+				`"since":{"scm":{"mergebase-with":"main"}}}]` + "\n",
+			response: `{"clock":{"clock":"c:1531594843:978:9:345",` +
+				`"scm":{"mergebase":"f0e8a2c1","mergebase-with":"main"}},` +
+				`"subscribe":"sub1","version":"4.9.0"}` + "\n",
+			req: &SubscribeRequest{
+				Root: "/tmp",
+				Name: "sub1",
+				Query: Query{
+					Fields:        []string{"name", "exists"},
+					MergeBaseWith: "main",
+				},
+			},
+			res: &SubscribeResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+						"clock": map[string]interface{}{
+							"clock": "c:1531594843:978:9:345",
+							"scm": map[string]interface{}{
+								"mergebase":      "f0e8a2c1",
+								"mergebase-with": "main",
+							},
+						},
+						"subscribe": "sub1",
+					},
+					version: "4.9.0",
+				},
+				scm: scm{
+					mergeBase:     "f0e8a2c1",
+					mergeBaseWith: "main",
+				},
+				clock:        "c:1531594843:978:9:345",
+				subscription: "sub1",
+			},
+		},
 	} {
 		requested := &bytes.Buffer{}
 		c := &Connection{
@@ -62,6 +100,7 @@ func TestSubscribe(t *testing.T) {
 		require.Equal("4.9.0", actual.Version())
 		require.Equal("c:1531594843:978:9:345", actual.Clock())
 		require.Equal("sub1", actual.Subscription())
+		require.Equal(tc.res.mergeBase, actual.MergeBase())
 	}
 }
 
@@ -109,10 +148,44 @@ func TestNewSubscription(t *testing.T) {
 				root:            "/tmp",
 				subscription:    "sub2",
 				isFreshInstance: true,
-				files: []map[string]interface{}{
-					{"name": "foo/main.go", "exists": true},
-					{"name": "bar/main.go", "exists": true},
+				files: []interface{}{
+					map[string]interface{}{
+						"name": "foo/main.go", "exists": true,
+					},
+					map[string]interface{}{
+						"name": "bar/main.go", "exists": true,
+					},
+				},
+			},
+		},
+		{
+			pdu: ResponsePDU{
+				"unilateral":   true,
+				"subscription": "sub3",
+				"root":         "/tmp",
+				"clock":        "c:1531594843:978:9:827",
+				"state-leave":  "hg.update",
+				"abandoned":    true,
+				"metadata":     map[string]interface{}{"rev": "abc123"},
+			},
+			sub: &Subscription{
+				response: response{
+					pdu: ResponsePDU{
+						"unilateral":   true,
+						"subscription": "sub3",
+						"root":         "/tmp",
+						"clock":        "c:1531594843:978:9:827",
+						"state-leave":  "hg.update",
+						"abandoned":    true,
+						"metadata":     map[string]interface{}{"rev": "abc123"},
+					},
 				},
+				clock:        "c:1531594843:978:9:827",
+				root:         "/tmp",
+				subscription: "sub3",
+				stateLeave:   "hg.update",
+				abandoned:    true,
+				metadata:     map[string]interface{}{"rev": "abc123"},
 			},
 		},
 	} {
@@ -128,16 +201,27 @@ func TestSubscription(t *testing.T) {
 		clock:        "c:2642605954:867:8:937",
 		root:         "/projects/x",
 		subscription: "sub42",
-		files: []map[string]interface{}{
-			{"name": "secrets.txt", "exists": true},
-		},
+		files: json.RawMessage(
+			`[{"name":"secrets.txt","exists":true,"size":42}]`,
+		),
 		isFreshInstance: true,
+		canceled:        true,
+		stateEnter:      "hg.update",
+		metadata:        "meta",
 	}
 	require.Equal("c:2642605954:867:8:937", s.Clock())
+	require.Equal(false, s.IsAbandoned())
+	require.Equal(true, s.IsCanceled())
 	require.Equal(true, s.IsFreshInstance())
+	require.Equal("meta", s.Metadata())
+	require.Equal("hg.update", s.StateEnter())
+	require.Equal("", s.StateLeave())
 	require.Equal("/projects/x", s.Root())
 	require.Equal("sub42", s.Subscription())
 	require.Equal([]map[string]interface{}{
-		{"name": "secrets.txt", "exists": true},
+		{"name": "secrets.txt", "exists": true, "size": float64(42)},
 	}, s.Files())
+	require.Equal([]File{
+		{Name: "secrets.txt", Exists: true, Size: 42},
+	}, s.TypedFiles())
 }
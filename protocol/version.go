@@ -0,0 +1,67 @@
+package protocol
+
+/*
+$ watchman version
+{"version":"4.9.0"}
+
+["version", {"required": ["term-match"], "optional": ["relative_root", "grant-three-wishes"]}]
+{"version":"4.9.0","capabilities":{"grant-three-wishes":false,"relative_root":true,"term-match":true}}
+
+["version", {"required": ["grant-three-wishes"]}]
+{"error":"client required capability `grant-three-wishes` is not supported by this server","version":"4.9.0","capabilities":{"grant-three-wishes":false}}
+*/
+
+// A VersionRequest represents the Watchman version command.
+//
+// If Required or Optional are non-empty, the server reports whether it
+// supports each listed capability, and fails the request if any
+// required capability is missing.
+//
+// See also: https://facebook.github.io/watchman/docs/cmd/version.html
+type VersionRequest struct {
+	Required []string
+	Optional []string
+}
+
+// Args returns values used to encode a request PDU.
+func (req *VersionRequest) Args() []interface{} {
+	if len(req.Required) < 1 && len(req.Optional) < 1 {
+		return []interface{}{"version"}
+	}
+	m := map[string][]string{}
+	if len(req.Required) > 0 {
+		m["required"] = req.Required
+	}
+	if len(req.Optional) > 0 {
+		m["optional"] = req.Optional
+	}
+	return []interface{}{"version", m}
+}
+
+// A VersionResponse represents a response to the Watchman version command.
+type VersionResponse struct {
+	response
+	capabilities map[string]bool
+}
+
+// NewVersionResponse converts a ResponsePDU to VersionResponse
+func NewVersionResponse(pdu ResponsePDU) (res *VersionResponse) {
+	res = &VersionResponse{}
+	res.response.init(pdu)
+
+	if x, ok := pdu["capabilities"]; ok {
+		if capabilities, ok := x.(map[string]interface{}); ok {
+			res.capabilities = make(map[string]bool, len(capabilities))
+			for capability, x := range capabilities {
+				supported, _ := x.(bool)
+				res.capabilities[capability] = supported
+			}
+		}
+	}
+	return
+}
+
+// Capabilities reports whether each requested capability is supported.
+func (res *VersionResponse) Capabilities() map[string]bool {
+	return res.capabilities
+}
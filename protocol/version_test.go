@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		request  string
+		response string
+		req      *VersionRequest
+		res      *VersionResponse
+	}{
+		{
+			request:  `["version"]` + "\n",
+			response: `{"version":"4.9.0"}` + "\n",
+			req:      &VersionRequest{},
+			res: &VersionResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+					},
+					version: "4.9.0",
+				},
+			},
+		},
+		{
+			request: `["version",{` +
+				`"optional":["relative_root","grant-three-wishes"],` +
+				`"required":["term-match"]` +
+				"}]\n",
+			response: `{"version":"4.9.0","capabilities":{` +
+				`"grant-three-wishes":false,"relative_root":true,"term-match":true` +
+				"}}\n",
+			req: &VersionRequest{
+				Required: []string{"term-match"},
+				Optional: []string{"relative_root", "grant-three-wishes"},
+			},
+			res: &VersionResponse{
+				response: response{
+					pdu: ResponsePDU{
+						"version": "4.9.0",
+						"capabilities": map[string]interface{}{
+							"grant-three-wishes": false,
+							"relative_root":      true,
+							"term-match":         true,
+						},
+					},
+					version: "4.9.0",
+				},
+				capabilities: map[string]bool{
+					"grant-three-wishes": false,
+					"relative_root":      true,
+					"term-match":         true,
+				},
+			},
+		},
+	} {
+		requested := &bytes.Buffer{}
+		c := &Connection{
+			reader: bufio.NewReader(
+				bytes.NewReader([]byte(tc.response)),
+			),
+			socket: requested,
+		}
+
+		err := c.Send(tc.req)
+		require.NoError(err)
+		require.Equal(tc.request, requested.String())
+
+		pdu, err := c.Recv()
+		require.NoError(err)
+		require.NotNil(pdu)
+		actual := NewVersionResponse(pdu)
+		require.Equal(tc.res, actual)
+		require.Equal("", actual.Warning())
+		require.Equal("4.9.0", actual.Version())
+		require.Equal(tc.res.capabilities, actual.Capabilities())
+	}
+}
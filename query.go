@@ -0,0 +1,135 @@
+package watchman
+
+import (
+	"fmt"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// A Query describes which files under a watched root to find.
+//
+// Generators (Glob, Path, Suffix, and Since) select the files considered
+// by the Watchman server, and are much faster than examining every file
+// in large trees. When more than one generator is used, the results are
+// combined.
+type Query struct {
+	// Since limits results to files changed after a clock value,
+	// such as one returned by Watch.Clock or a previous Query.
+	Since string
+	// MergeBaseWith makes the Query SCM-aware, limiting results to files
+	// changed since the merge base of the working copy and a revision,
+	// such as "main". Requires the "scm-since" capability.
+	MergeBaseWith string
+	// ContentSHA1 requests the SHA-1 hash of each file's content.
+	// Requires the "field-content.sha1hex" capability.
+	ContentSHA1 bool
+
+	// Glob lists patterns matched against file names relative to the
+	// root, or to RelativeRoot. "**" matches any number of directories.
+	// Requires the "glob_generator" capability.
+	Glob []string
+	// IncludeDotFiles allows Glob wildcards to match names starting
+	// with a period.
+	IncludeDotFiles bool
+	// Path lists files and directories to examine.
+	Path []PathGenerator
+	// Suffix lists file name extensions, such as "go", to examine.
+	Suffix []string
+
+	// RelativeRoot limits results to a subdirectory, and makes file
+	// names relative to it. It is relative to the directory requested
+	// by AddWatch. Requires the "relative_root" capability.
+	RelativeRoot string
+
+	// Expression filters the files selected by generators.
+	Expression Expr
+}
+
+// A PathGenerator selects a file, or the contents of a directory up to
+// MaxDepth levels deep. A MaxDepth of 1 selects only the direct children
+// of a directory. The zero value is unlimited, like a bare path in the
+// Watchman protocol.
+type PathGenerator struct {
+	Name     string
+	MaxDepth int
+}
+
+// validate reports malformed glob patterns before they are sent to the
+// Watchman server.
+func (q *Query) validate() error {
+	for _, pattern := range q.Glob {
+		if err := checkPattern(pattern); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+	if q.Expression != nil {
+		return validateExpr(q.Expression)
+	}
+	return nil
+}
+
+func (q *Query) spec() protocol.Query {
+	spec := protocol.Query{
+		Since:               q.Since,
+		MergeBaseWith:       q.MergeBaseWith,
+		Glob:                q.Glob,
+		GlobIncludeDotFiles: q.IncludeDotFiles,
+		Suffix:              q.Suffix,
+		RelativeRoot:        q.RelativeRoot,
+	}
+	if q.Expression != nil {
+		spec.Expression = q.Expression.Term()
+	}
+	for _, p := range q.Path {
+		// Watchman counts the direct children of a directory as depth 0
+		spec.Path = append(spec.Path, protocol.PathGenerator{
+			Name:  p.Name,
+			Depth: p.MaxDepth - 1,
+		})
+	}
+	if q.ContentSHA1 {
+		spec.Fields = append(protocol.DefaultFields(), "content.sha1hex")
+	}
+	return spec
+}
+
+// A QueryResult represents the files matching a Query.
+type QueryResult struct {
+	// IsFreshInstance is true when Files lists every matching file,
+	// instead of only those changed since Query.Since.
+	IsFreshInstance bool
+	// Clock can be used as Query.Since to find later changes.
+	Clock string
+	// MergeBase is the current merge base, when Query.MergeBaseWith
+	// is set. If it differs from a previous result, IsFreshInstance
+	// is true and Files lists every file changed since MergeBase.
+	MergeBase string
+	Files     []File
+}
+
+// Query finds files under a watched root.
+//
+// For details, see: https://facebook.github.io/watchman/docs/cmd/query.html
+func (w *Watch) Query(q *Query) (*QueryResult, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	scoped := w.scope(*q)
+	req := &protocol.QueryRequest{
+		Root:  w.root,
+		Query: scoped.spec(),
+	}
+	pdu, err := w.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := protocol.NewQueryResponse(pdu)
+	clock := res.Clock()
+	return &QueryResult{
+		IsFreshInstance: res.IsFreshInstance(),
+		Clock:           clock,
+		MergeBase:       res.MergeBase(),
+		Files:           newFiles(res.TypedFiles(), clock),
+	}, nil
+}
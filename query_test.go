@@ -0,0 +1,172 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestWatchQuery(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":             "c:1531594843:978:9:346",
+			"is_fresh_instance": false,
+			"files": []interface{}{
+				map[string]interface{}{
+					"name": "foo", "type": "f", "size": 42,
+					"exists": true, "cclock": "c:1531594843:978:9:300",
+				},
+				map[string]interface{}{
+					"name": "bar", "type": "l", "size": 3,
+					"symlink_target": "foo",
+					"exists":         false, "cclock": "c:1531594843:978:9:300",
+				},
+			},
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	result, err := w.Query(&Query{Since: "c:1531594843:978:9:345"})
+	require.NoError(err)
+	args := s.last("query")
+	require.Equal("/tmp", args[1])
+	require.Equal("c:1531594843:978:9:345", args[2].(map[string]interface{})["since"])
+	require.Equal(&QueryResult{
+		Clock: "c:1531594843:978:9:346",
+		Files: []File{
+			{Change: Updated, Name: "foo", Type: "f", Size: 42},
+			{Change: Removed, Name: "bar", Type: "l", Target: "foo", Size: 3},
+		},
+	}, result)
+}
+
+func TestSCMQuery(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	c := s.connect()
+	w := &Watch{client: c, root: "/tmp"}
+	_, err := w.Query(&Query{MergeBaseWith: "main"})
+	require.Equal(&protocol.CapabilityError{Missing: []string{"scm-since"}}, err)
+	c.Close()
+
+	s = newFakeServer(t, "scm-since")
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock": map[string]interface{}{
+				"clock": "c:1531594843:978:9:346",
+				"scm": map[string]interface{}{
+					"mergebase":      "f0e8a2c1",
+					"mergebase-with": "main",
+				},
+			},
+			"is_fresh_instance": true,
+			"files": []interface{}{
+				map[string]interface{}{
+					"name": "foo", "type": "f", "size": 42,
+					"exists": true, "cclock": "c:1531594843:978:9:300",
+				},
+			},
+		}
+	})
+
+	c = s.connect()
+	defer c.Close()
+
+	w = &Watch{client: c, root: "/tmp"}
+	result, err := w.Query(&Query{MergeBaseWith: "main"})
+	require.NoError(err)
+	require.Equal(map[string]interface{}{
+		"scm": map[string]interface{}{"mergebase-with": "main"},
+	}, s.last("query")[2].(map[string]interface{})["since"])
+	require.Equal(&QueryResult{
+		IsFreshInstance: true,
+		Clock:           "c:1531594843:978:9:346",
+		MergeBase:       "f0e8a2c1",
+		Files: []File{
+			{Change: Updated, Name: "foo", Type: "f", Size: 42},
+		},
+	}, result)
+}
+
+func TestQueryTermCapabilities(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "term-allof", "term-suffix")
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	_, err := w.Query(&Query{
+		Expression: AllOf{
+			Suffix{Suffixes: []string{"c", "h"}},
+			Not{Expr: Match{Pattern: "*_test.c"}},
+		},
+	})
+	require.Equal(&protocol.CapabilityError{
+		Missing: []string{"suffix-set", "term-not", "term-match"},
+	}, err)
+	require.Equal([]string{"list-capabilities"}, s.historyOf(0))
+}
+
+func TestQueryGenerators(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t,
+		"glob_generator", "relative_root", "term-not", "term-dirname",
+	)
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":             "c:1531594843:978:9:346",
+			"is_fresh_instance": true,
+			"files":             []interface{}{},
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	_, err := w.Query(&Query{Glob: []string{"[a-"}})
+	require.Error(err)
+	require.Contains(err.Error(), `invalid glob "[a-"`)
+	_, err = w.Query(&Query{Expression: AllOf{Exists{}, Not{PCRE{Pattern: "(a"}}}})
+	require.Error(err)
+	require.Contains(err.Error(), `invalid pcre "(a"`)
+
+	result, err := w.Query(&Query{
+		Glob:            []string{"**/*.go"},
+		IncludeDotFiles: true,
+		Path: []PathGenerator{
+			{Name: "cmd", MaxDepth: 2},
+			{Name: "docs"},
+		},
+		Suffix:       []string{"mod"},
+		RelativeRoot: "src",
+		Expression:   Not{Expr: DirName{Path: "vendor"}},
+	})
+	require.NoError(err)
+	require.Equal(true, result.IsFreshInstance)
+	require.Len(s.history(), 2)
+
+	spec := s.last("query")[2].(map[string]interface{})
+	require.Equal([]interface{}{"**/*.go"}, spec["glob"])
+	require.Equal(true, spec["glob_includedotfiles"])
+	require.Equal([]interface{}{
+		map[string]interface{}{"path": "cmd", "depth": float64(1)},
+		"docs",
+	}, spec["path"])
+	require.Equal([]interface{}{"mod"}, spec["suffix"])
+	require.Equal("src", spec["relative_root"])
+	require.Equal([]interface{}{
+		"not", []interface{}{"dirname", "vendor"},
+	}, spec["expression"])
+}
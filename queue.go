@@ -0,0 +1,195 @@
+package watchman
+
+import (
+	"sync"
+	"time"
+)
+
+// An OverflowPolicy determines what happens when notifications for a
+// subscription arrive faster than they are consumed.
+type OverflowPolicy int
+
+const (
+	// Block - stop reading from the Watchman server until there is
+	// room in the buffer, delaying every request made by the Client
+	Block OverflowPolicy = iota
+	// DropOldest - discard the oldest buffered notification
+	DropOldest
+	// Coalesce - replace every buffered notification with a single
+	// OverflowNotification, indicating that a new query is needed
+	Coalesce
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case Coalesce:
+		return "coalesce"
+	}
+	return "invalid"
+}
+
+// An OverflowNotification replaces notifications discarded by the
+// Coalesce policy. The Files of the subscription should be queried
+// again, because an unknown set of changes has been missed.
+type OverflowNotification struct {
+	Subscription string
+	// Dropped is the number of notifications replaced.
+	Dropped uint64
+}
+
+// queue buffers notifications for one subscription, so that a slow
+// consumer does not stall the eventloop unless the Block policy is used.
+type queue struct {
+	name   string
+	policy OverflowPolicy
+	size   int
+	// filter, if set, may modify or discard (by returning nil)
+	// notifications before they are buffered
+	filter func(Event) Event
+	// deliveryFilter, if set, is like filter, but is applied to
+	// notifications after they are buffered, by the goroutine
+	// delivering them
+	deliveryFilter func(Event) Event
+	// handler, if set, receives notifications instead of the updates
+	// channel of the Client. It should return early if quit is closed.
+	handler func(e Event, quit <-chan struct{})
+	// stopped, if set, is called once every notification has been
+	// delivered, if the queue was closed because the connection to
+	// the Watchman server was closed or lost
+	stopped func()
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	dropped uint64
+	items   []queued
+}
+
+type queued struct {
+	item     Event
+	received time.Time
+}
+
+// lag returns the time since the most recent change in a notification,
+// according to the Watchman server, or if unknown, since it was
+// received.
+func (x *queued) lag() time.Duration {
+	if cn, ok := x.item.(*ChangeNotification); ok && !cn.changed.IsZero() {
+		return time.Since(cn.changed)
+	}
+	return time.Since(x.received)
+}
+
+func newQueue(name string, size int, policy OverflowPolicy) *queue {
+	if size < 1 {
+		size = 1
+	}
+	q := &queue{
+		name:   name,
+		policy: policy,
+		size:   size,
+		items:  make([]queued, 0, size),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a notification, applying the overflow policy if the
+// queue is full.
+func (q *queue) push(item Event) {
+	if q.filter != nil {
+		if item = q.filter(item); item == nil {
+			return
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.size {
+		switch q.policy {
+		case DropOldest:
+			q.items[0] = queued{}
+			q.items = q.items[1:]
+			q.dropped++
+		case Coalesce:
+			var previous, n uint64 = 0, 1
+			received := time.Now()
+			for i, x := range q.items {
+				if overflow, ok := x.item.(*OverflowNotification); ok {
+					previous += overflow.Dropped
+				} else {
+					n++
+				}
+				if i == 0 {
+					received = x.received
+				}
+				q.items[i] = queued{}
+			}
+			q.dropped += n
+			q.items = append(q.items[:0], queued{
+				item: &OverflowNotification{
+					Subscription: q.name,
+					Dropped:      previous + n,
+				},
+				received: received,
+			})
+			q.cond.Broadcast()
+			return
+		default:
+			for len(q.items) >= q.size && !q.closed {
+				q.cond.Wait()
+			}
+		}
+	}
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, queued{item: item, received: time.Now()})
+	q.cond.Broadcast()
+}
+
+// pop removes the oldest notification, waiting until one is available.
+// It returns false once the queue is closed and empty.
+func (q *queue) pop() (Event, bool) {
+	x, ok := q.popQueued()
+	return x.item, ok
+}
+
+// popQueued is like pop, but also returns when the notification was
+// received.
+func (q *queue) popQueued() (queued, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) < 1 {
+		if q.closed {
+			return queued{}, false
+		}
+		q.cond.Wait()
+	}
+	x := q.items[0]
+	q.items[0] = queued{}
+	q.items = q.items[1:]
+	q.cond.Broadcast()
+	return x, true
+}
+
+// close wakes any waiting goroutines. Buffered notifications can still
+// be popped, but new notifications are discarded.
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *queue) stats() (buffered int, dropped uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items), q.dropped
+}
@@ -0,0 +1,96 @@
+package watchman
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// numbered returns a distinct Event for each n.
+func numbered(n int) Event {
+	return &ChangeNotification{Clock: strconv.Itoa(n)}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	require := require.New(t)
+
+	var p OverflowPolicy = -1
+	require.Equal("invalid", p.String())
+	require.Equal("block", Block.String())
+	require.Equal("drop-oldest", DropOldest.String())
+	require.Equal("coalesce", Coalesce.String())
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	require := require.New(t)
+
+	q := newQueue("sub1", 2, DropOldest)
+	for i := 1; i <= 5; i++ {
+		q.push(numbered(i))
+	}
+	buffered, dropped := q.stats()
+	require.Equal(2, buffered)
+	require.Equal(uint64(3), dropped)
+
+	item, ok := q.pop()
+	require.True(ok)
+	require.Equal(numbered(4), item)
+
+	q.close()
+	q.push(numbered(6))
+	item, ok = q.pop()
+	require.True(ok)
+	require.Equal(numbered(5), item)
+	_, ok = q.pop()
+	require.False(ok)
+}
+
+func TestQueueCoalesce(t *testing.T) {
+	require := require.New(t)
+
+	q := newQueue("sub1", 2, Coalesce)
+	q.push(numbered(1))
+	q.push(numbered(2))
+	q.push(numbered(3))
+	require.Equal(uint64(3), q.dropped)
+	q.push(numbered(4))
+	q.push(numbered(5))
+	require.Equal(uint64(5), q.dropped)
+
+	item, ok := q.pop()
+	require.True(ok)
+	require.Equal(&OverflowNotification{
+		Subscription: "sub1",
+		Dropped:      5,
+	}, item)
+	require.Empty(q.items)
+}
+
+func TestQueueBlock(t *testing.T) {
+	require := require.New(t)
+
+	q := newQueue("sub1", 1, Block)
+	q.push(numbered(1))
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push(numbered(2))
+		close(pushed)
+	}()
+
+	item, ok := q.pop()
+	require.True(ok)
+	require.Equal(numbered(1), item)
+	<-pushed
+
+	item, ok = q.pop()
+	require.True(ok)
+	require.Equal(numbered(2), item)
+
+	q.push(numbered(3))
+	go q.push(numbered(4))
+	q.close()
+	_, dropped := q.stats()
+	require.Equal(uint64(0), dropped)
+}
@@ -0,0 +1,5 @@
+// Package server starts private Watchman servers, isolated from the
+// server shared by the current user. It is primarily intended for
+// tests that must not interfere with each other, or with a developer's
+// own watches.
+package server
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sjansen/watchman"
+)
+
+// An Option configures how Start launches a Server.
+type Option func(*options)
+
+type options struct {
+	binary       string
+	client       []watchman.Option
+	readyTimeout time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		binary:       "watchman",
+		readyTimeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithBinary sets the path of the watchman executable. By default,
+// "watchman" is found using PATH.
+func WithBinary(path string) Option {
+	return func(o *options) {
+		o.binary = path
+	}
+}
+
+// WithClientOptions configures the Client returned by Server.Client.
+func WithClientOptions(opts ...watchman.Option) Option {
+	return func(o *options) {
+		o.client = append(o.client, opts...)
+	}
+}
+
+// WithReadyTimeout limits how long Start waits for the server to accept
+// connections. The default is 10 seconds.
+func WithReadyTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readyTimeout = timeout
+	}
+}
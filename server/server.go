@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/sjansen/watchman"
+	"github.com/sjansen/watchman/protocol"
+)
+
+const pollInterval = 10 * time.Millisecond
+
+// A Server represents a private Watchman server process, and a Client
+// connected to it.
+type Server struct {
+	client   *watchman.Client
+	cmd      *exec.Cmd
+	dir      string
+	exited   chan struct{}
+	exitErr  error
+	sockname string
+	opts     *options
+}
+
+// Start launches a new Watchman server using a temporary directory for
+// its socket, state, log, and pid files, waits until it is accepting
+// connections, and returns a Server with a connected Client.
+func Start(opts ...Option) (s *Server, err error) {
+	o := newOptions(opts)
+
+	dir, err := ioutil.TempDir("", "watchman-server")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	config := filepath.Join(dir, "watchman.json")
+	if err = ioutil.WriteFile(config, []byte("{}\n"), 0o644); err != nil {
+		return nil, err
+	}
+
+	sockname := filepath.Join(dir, "sock")
+	if runtime.GOOS == "windows" {
+		sockname = `\\.\pipe\` + filepath.Base(dir)
+	}
+
+	cmd := exec.Command(o.binary,
+		"--foreground",
+		"--sockname="+sockname,
+		"--statefile="+filepath.Join(dir, "state"),
+		"--logfile="+filepath.Join(dir, "log"),
+		"--pidfile="+filepath.Join(dir, "pid"),
+	)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"WATCHMAN_CONFIG_FILE="+config,
+		"WATCHMAN_SOCK="+sockname,
+	)
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	s = &Server{
+		cmd:      cmd,
+		dir:      dir,
+		exited:   make(chan struct{}),
+		sockname: sockname,
+		opts:     o,
+	}
+	go func() {
+		s.exitErr = cmd.Wait()
+		close(s.exited)
+	}()
+
+	if s.client, err = s.waitUntilReady(); err != nil {
+		s.kill()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) waitUntilReady() (*watchman.Client, error) {
+	deadline := time.Now().Add(s.opts.readyTimeout)
+	for {
+		c, err := s.Connect(s.opts.client...)
+		if err == nil {
+			return c, nil
+		}
+
+		select {
+		case <-s.exited:
+			return nil, fmt.Errorf(
+				"watchman exited before accepting connections: %v (see %s)",
+				s.exitErr, s.LogFile(),
+			)
+		case <-time.After(pollInterval):
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf(
+				"timed out waiting for watchman: %v (see %s)",
+				err, s.LogFile(),
+			)
+		}
+	}
+}
+
+func (s *Server) kill() {
+	s.cmd.Process.Kill()
+	<-s.exited
+}
+
+// Client returns the Client connected to the server by Start.
+func (s *Server) Client() *watchman.Client {
+	return s.client
+}
+
+// Close stops the server, closes its Client, and removes the temporary
+// directory. The server is asked to exit using shutdown-server, and is
+// killed if it fails to exit within the ready timeout.
+func (s *Server) Close() error {
+	defer os.RemoveAll(s.dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.readyTimeout)
+	defer cancel()
+
+	_, err := s.client.Do(ctx, &protocol.ShutdownServerRequest{})
+	if err == watchman.ErrClosed {
+		// the server may exit before its response is received
+		err = nil
+	}
+	s.client.Close()
+
+	select {
+	case <-s.exited:
+	case <-ctx.Done():
+		s.kill()
+	}
+	return err
+}
+
+// Connect returns an additional Client connected to the server.
+func (s *Server) Connect(opts ...watchman.Option) (*watchman.Client, error) {
+	opts = append([]watchman.Option{
+		watchman.WithBinary(s.opts.binary),
+		watchman.WithSockName(s.sockname),
+	}, opts...)
+	return watchman.Connect(opts...)
+}
+
+// Dir returns the temporary directory containing the server's files.
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// LogFile returns the location of the server's log file.
+func (s *Server) LogFile() string {
+	return filepath.Join(s.dir, "log")
+}
+
+// SockName returns the location of the socket used to communicate
+// with the server.
+func (s *Server) SockName() string {
+	return s.sockname
+}
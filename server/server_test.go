@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_WATCHMAN") == "1" {
+		fakeWatchman(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// fakeWatchman is run in a subprocess, in place of the watchman binary.
+func fakeWatchman(args []string) {
+	var sockname string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--sockname=") {
+			sockname = strings.TrimPrefix(arg, "--sockname=")
+		}
+	}
+	if _, err := os.Stat(os.Getenv("WATCHMAN_CONFIG_FILE")); err != nil {
+		os.Exit(2)
+	}
+
+	l, err := net.Listen("unix", sockname)
+	if err != nil {
+		os.Exit(3)
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			os.Exit(4)
+		}
+		go func() {
+			r := bufio.NewReader(conn)
+			enc := json.NewEncoder(conn)
+			for {
+				line, err := r.ReadBytes('\n')
+				if err != nil {
+					return
+				}
+				var req []string
+				json.Unmarshal(line, &req)
+				switch req[0] {
+				case "list-capabilities":
+					enc.Encode(map[string]interface{}{
+						"version":      "4.9.0",
+						"capabilities": []string{"cmd-shutdown-server"},
+					})
+				case "shutdown-server":
+					enc.Encode(map[string]interface{}{
+						"version":         "4.9.0",
+						"shutdown-server": true,
+					})
+					os.Remove(sockname)
+					os.Exit(0)
+				}
+			}
+		}()
+	}
+}
+
+func TestServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake watchman requires UNIX domain sockets")
+	}
+	require := require.New(t)
+	t.Setenv("FAKE_WATCHMAN", "1")
+
+	s, err := Start(WithBinary(os.Args[0]))
+	require.NoError(err)
+	require.NotNil(s.Client())
+	require.Equal(s.SockName(), s.Client().SockName())
+	require.Equal("4.9.0", s.Client().Version())
+	require.DirExists(s.Dir())
+
+	c, err := s.Connect()
+	require.NoError(err)
+	require.True(c.HasCapability("cmd-shutdown-server"))
+	require.NoError(c.Close())
+
+	require.NoError(s.Close())
+	require.NoDirExists(s.Dir())
+	<-s.exited
+	require.NoError(s.exitErr)
+}
+
+func TestServerExitsEarly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake watchman requires UNIX domain sockets")
+	}
+	require := require.New(t)
+
+	s, err := Start(WithBinary("false"))
+	require.Nil(s)
+	require.Error(err)
+	require.Contains(err.Error(), "watchman exited")
+}
@@ -2,11 +2,148 @@ package watchman
 
 import "github.com/sjansen/watchman/protocol"
 
+const defaultBufferSize = 16
+
 // A Subscription represents a request to receive notification of changes to a watched root.
 type Subscription struct {
 	client *Client
 	name   string
 	root   string
+	queue  *queue
+}
+
+// A SubscribeOption configures a Subscription.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	bufferSize int
+	policy     OverflowPolicy
+	query      *Query
+	noTouches  bool
+	ignore     *IgnoreFilter
+	handler    func(e Event, quit <-chan struct{})
+	stopped    func()
+}
+
+func newSubscribeOptions(opts []SubscribeOption) *subscribeOptions {
+	o := &subscribeOptions{
+		bufferSize: defaultBufferSize,
+		policy:     Coalesce,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// filter returns a function applying the filters enabled by options
+// before notifications are buffered, or nil if there are none.
+func (o *subscribeOptions) filter() func(Event) Event {
+	if o.noTouches {
+		return newTouchFilter().filter
+	}
+	return nil
+}
+
+// deliveryFilter returns a function applying the filters enabled by
+// options that may block, such as by reading files, or nil if there
+// are none. It is applied as notifications are delivered, so that the
+// eventloop is not stalled.
+func (o *subscribeOptions) deliveryFilter() func(Event) Event {
+	if o.ignore == nil {
+		return nil
+	}
+	return func(item Event) Event {
+		if cn, ok := item.(*ChangeNotification); ok {
+			if cn = o.ignore.Filter(cn); cn == nil {
+				return nil
+			}
+			return cn
+		}
+		return item
+	}
+}
+
+// WithBuffer sets how many notifications can be buffered for the
+// subscription while waiting to be read from Notifications, and what
+// happens when the buffer is full. The default is to buffer 16
+// notifications using the Coalesce policy.
+func WithBuffer(size int, policy OverflowPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.bufferSize = size
+		o.policy = policy
+	}
+}
+
+// WithQuery limits notifications to files matching q. For example,
+// setting Query.MergeBaseWith creates an SCM-aware subscription.
+func WithQuery(q *Query) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.query = q
+	}
+}
+
+// WithoutTouches suppresses Updated notifications for files whose
+// content has not changed, such as when only the modification time was
+// changed. It implies Query.ContentSHA1.
+func WithoutTouches() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.noTouches = true
+	}
+}
+
+// touchFilter remembers the content hash of every file reported by a
+// subscription, and removes files whose hash is unchanged.
+type touchFilter struct {
+	hashes map[string]string
+}
+
+func newTouchFilter() *touchFilter {
+	return &touchFilter{hashes: map[string]string{}}
+}
+
+func (f *touchFilter) filter(item Event) Event {
+	cn, ok := item.(*ChangeNotification)
+	if !ok {
+		return item
+	}
+
+	files := cn.Files[:0:0]
+	for _, file := range cn.Files {
+		switch file.Change {
+		case Removed, Ephemeral:
+			delete(f.hashes, file.Name)
+		case Updated:
+			previous, ok := f.hashes[file.Name]
+			if ok && file.ContentSHA1 != "" && previous == file.ContentSHA1 {
+				continue
+			}
+			fallthrough
+		default:
+			f.hashes[file.Name] = file.ContentSHA1
+		}
+		files = append(files, file)
+	}
+	if len(files) < 1 && len(cn.Files) > 0 && !cn.IsFreshInstance {
+		return nil
+	}
+
+	filtered := *cn
+	filtered.Files = files
+	return &filtered
+}
+
+// Buffered returns the number of notifications waiting to be delivered.
+func (s *Subscription) Buffered() int {
+	buffered, _ := s.queue.stats()
+	return buffered
+}
+
+// Dropped returns the number of notifications discarded because the
+// buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	_, dropped := s.queue.stats()
+	return dropped
 }
 
 // Unsubscribe cancels a subscription.
@@ -16,6 +153,7 @@ func (s *Subscription) Unsubscribe() (err error) {
 		Root: s.root,
 	}
 	_, err = s.client.send(req)
+	s.client.loop.unregister(s.queue)
 
 	return
 }
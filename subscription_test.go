@@ -0,0 +1,209 @@
+package watchman
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestSlowConsumer(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("unsubscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"unsubscribe": args[2],
+			"deleted":     true,
+		}
+	})
+	s.handle("version", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	sub, err := w.SubscribeChanges("sub1", WithBuffer(2, DropOldest))
+	require.NoError(err)
+
+	for i := 2; i <= 11; i++ {
+		s.send(protocol.ResponsePDU{
+			"unilateral":   true,
+			"subscription": "sub1",
+			"clock":        fmt.Sprintf("c:1531594843:978:9:%d", i),
+			"files":        []interface{}{},
+		})
+	}
+
+	// requests are not blocked by unread notifications
+	_, err = c.Do(context.Background(), protocol.RawRequest{"version"})
+	require.NoError(err)
+	require.LessOrEqual(sub.Buffered(), 2)
+	require.Contains([]uint64{7, 8}, sub.Dropped())
+
+	// the newest notifications are kept
+	for cn := range c.Notifications() {
+		if cn.(*ChangeNotification).Clock == "c:1531594843:978:9:11" {
+			break
+		}
+	}
+
+	require.NoError(sub.Unsubscribe())
+}
+
+func TestDefaultOverflowPolicy(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("version", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	sub, err := w.SubscribeChanges("sub1")
+	require.NoError(err)
+
+	for i := 2; i <= defaultBufferSize+11; i++ {
+		s.send(protocol.ResponsePDU{
+			"unilateral":   true,
+			"subscription": "sub1",
+			"clock":        fmt.Sprintf("c:1531594843:978:9:%d", i),
+			"files":        []interface{}{},
+		})
+	}
+
+	// requests are not blocked by unread notifications
+	_, err = c.Do(context.Background(), protocol.RawRequest{"version"})
+	require.NoError(err)
+	require.NotZero(sub.Dropped())
+
+	// the consumer learns that notifications were missed
+	for e := range c.Notifications() {
+		if overflow, ok := e.(*OverflowNotification); ok {
+			require.Equal("sub1", overflow.Subscription)
+			require.NotZero(overflow.Dropped)
+			break
+		}
+	}
+}
+
+func TestSCMSubscription(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "scm-since")
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	_, err := w.SubscribeChanges("sub1",
+		WithQuery(&Query{MergeBaseWith: "main"}),
+	)
+	require.NoError(err)
+	require.Equal(map[string]interface{}{
+		"scm": map[string]interface{}{"mergebase-with": "main"},
+	}, s.last("subscribe")[3].(map[string]interface{})["since"])
+
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock": map[string]interface{}{
+			"clock": "c:1531594843:978:9:2",
+			"scm": map[string]interface{}{
+				"mergebase":      "f0e8a2c1",
+				"mergebase-with": "main",
+			},
+		},
+		"is_fresh_instance": true,
+		"files":             []interface{}{},
+	})
+	cn := (<-c.Notifications()).(*ChangeNotification)
+	require.Equal(&ChangeNotification{
+		IsFreshInstance: true,
+		Clock:           "c:1531594843:978:9:2",
+		MergeBase:       "f0e8a2c1",
+		Subscription:    "sub1",
+		Files:           []File{},
+	}, cn)
+}
+
+func TestWithoutTouches(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "field-content.sha1hex")
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := &Watch{client: c, root: "/tmp"}
+	_, err := w.SubscribeChanges("sub1", WithoutTouches())
+	require.NoError(err)
+	spec := s.last("subscribe")[3].(map[string]interface{})
+	require.Contains(spec["fields"], "content.sha1hex")
+
+	file := func(name, sha1 string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name, "type": "f", "size": 42, "exists": true,
+			"cclock": "c:1531594843:978:9:1", "content.sha1hex": sha1,
+		}
+	}
+	for i, files := range [][]interface{}{
+		{file("foo", "aaaa")},
+		{file("foo", "aaaa")},
+		{file("foo", "bbbb"), file("bar", "cccc")},
+	} {
+		s.send(protocol.ResponsePDU{
+			"unilateral":        true,
+			"subscription":      "sub1",
+			"clock":             fmt.Sprintf("c:1531594843:978:9:%d", i+2),
+			"is_fresh_instance": i == 0,
+			"files":             files,
+		})
+	}
+
+	cn := (<-c.Notifications()).(*ChangeNotification)
+	require.Equal("c:1531594843:978:9:2", cn.Clock)
+	require.Equal([]File{
+		{Change: Updated, Name: "foo", Type: "f", Size: 42, ContentSHA1: "aaaa"},
+	}, cn.Files)
+
+	// the touch-only update is suppressed
+	cn = (<-c.Notifications()).(*ChangeNotification)
+	require.Equal("c:1531594843:978:9:4", cn.Clock)
+	require.Equal([]File{
+		{Change: Updated, Name: "foo", Type: "f", Size: 42, ContentSHA1: "bbbb"},
+		{Change: Updated, Name: "bar", Type: "f", Size: 42, ContentSHA1: "cccc"},
+	}, cn.Files)
+}
@@ -0,0 +1,121 @@
+package watchman
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+// A Warning is an advisory notice from the Watchman server, which should
+// be shown to the user so that the system can operate more effectively.
+type Warning struct {
+	// Command is the request whose response included the warning, or
+	// "subscribe" for subscription notifications.
+	Command string
+	Message string
+	// Recrawl is set if the warning reports that the Watchman server
+	// recrawled a watched root, because it lost track of changes.
+	Recrawl *Recrawl
+}
+
+// Recrawl describes a recrawl of a watched root.
+type Recrawl struct {
+	// Count is the number of times the root has been recrawled.
+	Count int
+	// Reason describes the most recent cause of a recrawl.
+	Reason string
+}
+
+var recrawlPattern = regexp.MustCompile(
+	`Recrawled this watch (\d+) times?, most recently because:\n([^\n]*)`,
+)
+
+func newWarning(command, message string) *Warning {
+	w := &Warning{
+		Command: command,
+		Message: message,
+	}
+	if m := recrawlPattern.FindStringSubmatch(message); m != nil {
+		count, _ := strconv.Atoi(m[1])
+		w.Recrawl = &Recrawl{
+			Count:  count,
+			Reason: m[2],
+		}
+	}
+	return w
+}
+
+// InotifyLimit reports whether the warning was caused by reaching the
+// limit on the number of inotify watches. On Linux, the limit can be
+// raised using the fs.inotify.max_user_watches sysctl.
+func (w *Warning) InotifyLimit() bool {
+	return strings.Contains(w.Message, "max_user_watches")
+}
+
+// WithWarningHandler sets a function to be called with warnings included
+// in responses and notifications from the Watchman server. The Watchman
+// server repeats warnings until they are resolved, so each distinct
+// message is only passed to h once, ignoring the count of recrawls.
+// Clients created using the same Option, such as the members of a
+// ClientPool, share de-duplication.
+//
+// h is called by the goroutine that reads from the connection, and must
+// not block or send requests using the Client.
+func WithWarningHandler(h func(*Warning)) Option {
+	w := &warner{
+		handler: h,
+		seen:    map[string]struct{}{},
+	}
+	return func(o *options) {
+		o.warner = w
+	}
+}
+
+// maxSeenWarnings bounds how many distinct warnings a warner remembers.
+// Once reached, they are forgotten, so that each may be reported again.
+const maxSeenWarnings = 64
+
+// A warner de-duplicates warnings before calling a handler.
+type warner struct {
+	handler func(*Warning)
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// warningKey normalizes message for de-duplication, by removing the
+// count of recrawls, which changes every time a root is recrawled.
+func warningKey(message string) string {
+	return recrawlPattern.ReplaceAllString(message,
+		"Recrawled this watch, most recently because:\n$2",
+	)
+}
+
+// warn calls the handler if pdu includes a new warning.
+func (w *warner) warn(command string, pdu protocol.ResponsePDU) {
+	if w == nil {
+		return
+	}
+	message, _ := pdu["warning"].(string)
+	if message == "" {
+		return
+	}
+
+	key := warningKey(message)
+	w.mu.Lock()
+	_, seen := w.seen[key]
+	if !seen {
+		if len(w.seen) >= maxSeenWarnings {
+			w.seen = map[string]struct{}{}
+		}
+		w.seen[key] = struct{}{}
+	}
+	w.mu.Unlock()
+
+	if !seen {
+		w.handler(newWarning(command, message))
+	}
+}
@@ -0,0 +1,134 @@
+package watchman
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+const recrawlWarning = "Recrawled this watch 2 times, most recently because:\n" +
+	"/home/user/src: inotify-add-watch(/home/user/src/build) -> " +
+	"The user limit on the total number of inotify watches was reached; " +
+	"increase the fs.inotify.max_user_watches sysctl\n" +
+	"To resolve, please review the information on\n" +
+	"https://facebook.github.io/watchman/docs/troubleshooting.html#recrawl\n"
+
+func TestNewWarning(t *testing.T) {
+	for tc, expected := range map[string]*Warning{
+		"A plain warning": {
+			Command: "watch-project",
+			Message: "A plain warning",
+		},
+		recrawlWarning: {
+			Command: "watch-project",
+			Message: recrawlWarning,
+			Recrawl: &Recrawl{
+				Count: 2,
+				Reason: "/home/user/src: inotify-add-watch(/home/user/src/build) -> " +
+					"The user limit on the total number of inotify watches was reached; " +
+					"increase the fs.inotify.max_user_watches sysctl",
+			},
+		},
+		"Recrawled this watch 1 time, most recently because:\nsomething broke\n": {
+			Command: "watch-project",
+			Message: "Recrawled this watch 1 time, most recently because:\nsomething broke\n",
+			Recrawl: &Recrawl{Count: 1, Reason: "something broke"},
+		},
+	} {
+		actual := newWarning("watch-project", tc)
+		require.Equal(t, expected, actual)
+		require.Equal(t, tc == recrawlWarning, actual.InotifyLimit())
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var warnings []*Warning
+	handler := WithWarningHandler(func(w *Warning) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, w)
+	})
+
+	s := newFakeServer(t)
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"watch":   args[1],
+			"warning": recrawlWarning,
+		}
+	})
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	c := s.connect(handler)
+	defer c.Close()
+
+	w, err := c.AddWatch("/home/user/src")
+	require.NoError(err)
+	_, err = c.AddWatch("/home/user/src")
+	require.NoError(err)
+	_, err = w.SubscribeChanges("sub1")
+	require.NoError(err)
+
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock":        "c:1531594843:978:9:2",
+		"files":        []interface{}{},
+		"warning":      "Something else",
+	})
+	<-c.Notifications()
+	s.send(protocol.ResponsePDU{
+		"unilateral":   true,
+		"subscription": "sub1",
+		"clock":        "c:1531594843:978:9:3",
+		"files":        []interface{}{},
+		"warning":      strings.Replace(recrawlWarning, "2 times", "3 times", 1),
+	})
+	<-c.Notifications()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(warnings, 2)
+	require.Equal("watch-project", warnings[0].Command)
+	require.Equal(2, warnings[0].Recrawl.Count)
+	require.True(warnings[0].InotifyLimit())
+	require.Equal(&Warning{
+		Command: "subscribe",
+		Message: "Something else",
+	}, warnings[1])
+}
+
+func TestWarnerIsBounded(t *testing.T) {
+	require := require.New(t)
+
+	var n int
+	w := &warner{
+		handler: func(*Warning) { n++ },
+		seen:    map[string]struct{}{},
+	}
+	for i := 0; i < maxSeenWarnings*2; i++ {
+		w.warn("query", protocol.ResponsePDU{
+			"warning": fmt.Sprintf("warning %d", i),
+		})
+		require.LessOrEqual(len(w.seen), maxSeenWarnings)
+	}
+	require.Equal(maxSeenWarnings*2, n)
+
+	w.warn("query", protocol.ResponsePDU{"warning": recrawlWarning})
+	w.warn("query", protocol.ResponsePDU{
+		"warning": strings.Replace(recrawlWarning, "2 times", "5 times", 1),
+	})
+	require.Equal(maxSeenWarnings*2+1, n)
+}
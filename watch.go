@@ -1,18 +1,52 @@
 package watchman
 
 import (
+	"path"
 	"time"
 
 	"github.com/sjansen/watchman/protocol"
 )
 
-// A Watch represents a directory, or watched root, that Watchman is watching for changes.
+// A Watch represents a directory that Watchman is watching for changes.
+//
+// Watchman may choose to watch a parent of the requested directory, such
+// as the root of a version control repository. Queries and subscriptions
+// are then limited to the requested directory, and file names are
+// relative to it.
 type Watch struct {
-	client *Client
-	root   string
+	client   sender
+	root     string
+	relative string
+}
+
+// sender is implemented by Client and ClientPool.
+type sender interface {
+	send(req protocol.Request) (protocol.ResponsePDU, error)
+	// subscriber returns the Client that receives notifications
+	subscriber() *Client
 }
 
-// Clock returns the current clock value for a watched root.
+// RelativePath returns the requested directory relative to Root, or ""
+// if they are the same.
+func (w *Watch) RelativePath() string {
+	return w.relative
+}
+
+// Root returns the directory chosen by Watchman as the watched root.
+func (w *Watch) Root() string {
+	return w.root
+}
+
+// scope limits a query to the requested directory.
+func (w *Watch) scope(q Query) Query {
+	if w.relative != "" {
+		q.RelativeRoot = path.Join(w.relative, q.RelativeRoot)
+	}
+	return q
+}
+
+// Clock returns the current clock value for a watched root. Clock values
+// are shared by every directory under the root.
 //
 // For details, see: https://facebook.github.io/watchman/docs/cmd/clock.html
 func (w *Watch) Clock(syncTimeout time.Duration) (clock string, err error) {
@@ -29,19 +63,59 @@ func (w *Watch) Clock(syncTimeout time.Duration) (clock string, err error) {
 	return
 }
 
-// Subscribe requests notification when changes occur under a watched root.
-func (w *Watch) Subscribe(name, root string) (s *Subscription, err error) {
+// Subscribe requests notification when changes occur under the watched
+// directory.
+//
+// Deprecated: root is ignored; notifications always cover the watched
+// directory. Use SubscribeChanges instead.
+func (w *Watch) Subscribe(name, root string, opts ...SubscribeOption) (*Subscription, error) {
+	return w.SubscribeChanges(name, opts...)
+}
+
+// SubscribeChanges requests notification when changes occur under the
+// watched directory. Notifications are delivered by the Notifications
+// method of the Client.
+//
+// Each subscription buffers its notifications separately. Subscription
+// names must be unique for each Client.
+func (w *Watch) SubscribeChanges(name string, opts ...SubscribeOption) (s *Subscription, err error) {
+	o := newSubscribeOptions(opts)
+	var query Query
+	if o.query != nil {
+		query = *o.query
+	}
+	if o.noTouches {
+		query.ContentSHA1 = true
+	}
+	query = w.scope(query)
+	if err = query.validate(); err != nil {
+		return nil, err
+	}
 	req := &protocol.SubscribeRequest{
-		Name: name,
-		Root: root,
+		Name:  name,
+		Root:  w.root,
+		Query: query.spec(),
 	}
-	_, err = w.client.send(req)
-	if err == nil {
-		s = &Subscription{
-			client: w.client,
-			name:   name,
-			root:   root,
-		}
+
+	c := w.client.subscriber()
+	q := newQueue(name, o.bufferSize, o.policy)
+	q.filter = o.filter()
+	q.deliveryFilter = o.deliveryFilter()
+	q.handler = o.handler
+	q.stopped = o.stopped
+	// register before sending, to capture the initial notification
+	c.loop.register(q)
+	_, err = c.send(req)
+	if err != nil {
+		c.loop.unregister(q)
+		return nil, err
+	}
+
+	s = &Subscription{
+		client: c,
+		name:   name,
+		root:   w.root,
+		queue:  q,
 	}
 	return
 }
@@ -0,0 +1,74 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestWatchRelativePath(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "relative_root")
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"watch": "/src", "relative_path": "a/b"}
+	})
+	s.handle("query", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock": "c:1531594843:978:9:2",
+			"files": []interface{}{},
+		}
+	})
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("clock", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"clock": "c:1531594843:978:9:3"}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w, err := c.AddWatch("/src/a/b")
+	require.NoError(err)
+	require.Equal("/src", w.Root())
+	require.Equal("a/b", w.RelativePath())
+
+	_, err = w.Query(&Query{})
+	require.NoError(err)
+	_, err = w.Query(&Query{RelativeRoot: "c"})
+	require.NoError(err)
+	_, err = w.SubscribeChanges("sub1")
+	require.NoError(err)
+	_, err = w.Subscribe("sub2", "/ignored")
+	require.NoError(err)
+	clock, err := w.Clock(0)
+	require.NoError(err)
+	require.Equal("c:1531594843:978:9:3", clock)
+
+	var actual [][]interface{}
+	for _, args := range s.history() {
+		switch args[0] {
+		case "query":
+			spec := args[2].(map[string]interface{})
+			actual = append(actual, []interface{}{args[0], args[1], spec["relative_root"]})
+		case "subscribe":
+			spec := args[3].(map[string]interface{})
+			actual = append(actual, []interface{}{args[0], args[1], spec["relative_root"]})
+		case "clock":
+			actual = append(actual, []interface{}{args[0], args[1]})
+		}
+	}
+	require.Equal([][]interface{}{
+		{"query", "/src", "a/b"},
+		{"query", "/src", "a/b/c"},
+		{"subscribe", "/src", "a/b"},
+		{"subscribe", "/src", "a/b"},
+		{"clock", "/src"},
+	}, actual)
+}
@@ -0,0 +1,179 @@
+package watchman
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// A Watcher watches many directories, possibly in different projects,
+// and merges their notifications into a single stream. The names of
+// Files in notifications from a Watcher are absolute paths.
+type Watcher struct {
+	client sender
+	prefix string
+
+	// add serializes calls to Add
+	add           sync.Mutex
+	subscriptions map[string]*Subscription
+
+	mu     sync.Mutex
+	closed bool
+	ch     chan Event
+	done   chan struct{}
+	stop   sync.Once
+}
+
+var watcherID struct {
+	sync.Mutex
+	next int
+}
+
+// NewWatcher returns a Watcher that uses the Client.
+func (c *Client) NewWatcher() *Watcher {
+	return newWatcher(c)
+}
+
+// NewWatcher returns a Watcher that uses the pool.
+func (p *ClientPool) NewWatcher() *Watcher {
+	return newWatcher(p)
+}
+
+func newWatcher(s sender) *Watcher {
+	watcherID.Lock()
+	watcherID.next++
+	id := watcherID.next
+	watcherID.Unlock()
+
+	w := &Watcher{
+		client:        s,
+		prefix:        fmt.Sprintf("watcher-%d-", id),
+		subscriptions: map[string]*Subscription{},
+		ch:            make(chan Event),
+		done:          make(chan struct{}),
+	}
+	go w.closeOnDisconnect(s.subscriber().loop.done)
+	return w
+}
+
+// closeOnDisconnect closes the Notifications channel once the eventloop
+// receiving notifications exits, after it delivers every notification.
+func (w *Watcher) closeOnDisconnect(disconnected <-chan struct{}) {
+	select {
+	case <-disconnected:
+		w.closeChannel()
+	case <-w.done:
+	}
+}
+
+func (w *Watcher) closeChannel() {
+	// dispatch holds mu while sending, so ch can be closed safely
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+	}
+}
+
+// Add starts watching a directory. Directories that resolve to the same
+// watched root and relative path are only watched once.
+//
+// Each directory uses its own subscription, with relative_root set when
+// the Watchman server chooses a parent directory as the watched root.
+func (w *Watcher) Add(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	w.add.Lock()
+	defer w.add.Unlock()
+	if w.subscriptions == nil {
+		return ErrClosed
+	}
+
+	watch, err := addWatch(w.client, dir)
+	if err != nil {
+		return err
+	}
+
+	key := filepath.Join(watch.Root(), filepath.FromSlash(watch.RelativePath()))
+	if _, ok := w.subscriptions[key]; ok {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s%d", w.prefix, len(w.subscriptions)+1)
+	sub, err := watch.SubscribeChanges(name,
+		withHandler(func(e Event, quit <-chan struct{}) {
+			w.dispatch(key, e, quit)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	w.subscriptions[key] = sub
+	return nil
+}
+
+// Close cancels every subscription, and closes the Notifications channel.
+func (w *Watcher) Close() (err error) {
+	w.stop.Do(func() { close(w.done) })
+
+	w.add.Lock()
+	defer w.add.Unlock()
+	if w.subscriptions == nil {
+		return nil
+	}
+	for _, sub := range w.subscriptions {
+		if e := sub.Unsubscribe(); e != nil && err == nil {
+			err = e
+		}
+	}
+	w.subscriptions = nil
+
+	w.closeChannel()
+	return err
+}
+
+// Dirs returns the directories being watched.
+func (w *Watcher) Dirs() []string {
+	w.add.Lock()
+	defer w.add.Unlock()
+
+	dirs := make([]string, 0, len(w.subscriptions))
+	for dir := range w.subscriptions {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// Notifications returns a channel that emits notifications for every
+// watched directory. The channel is closed by Close, or if the
+// connection used for notifications is closed or lost.
+func (w *Watcher) Notifications() <-chan Event {
+	return w.ch
+}
+
+func (w *Watcher) dispatch(dir string, item Event, quit <-chan struct{}) {
+	if cn, ok := item.(*ChangeNotification); ok {
+		absolute := *cn
+		absolute.Files = make([]File, len(cn.Files))
+		for i, f := range cn.Files {
+			f.Name = filepath.Join(dir, filepath.FromSlash(f.Name))
+			absolute.Files[i] = f
+		}
+		item = &absolute
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.ch <- item:
+	case <-w.done:
+	case <-quit:
+	}
+}
@@ -0,0 +1,125 @@
+package watchman
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sjansen/watchman/protocol"
+)
+
+func TestWatcher(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t, "relative_root")
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		switch args[1] {
+		case "/src/a":
+			return protocol.ResponsePDU{"watch": "/src", "relative_path": "a"}
+		}
+		return protocol.ResponsePDU{"watch": args[1]}
+	})
+	var names []string
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		names = append(names, args[2].(string))
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+	s.handle("unsubscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"unsubscribe": args[2],
+			"deleted":     true,
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := c.NewWatcher()
+	require.NoError(w.Add("/src/a"))
+	require.NoError(w.Add("/src/a/b/../"))
+	require.NoError(w.Add("/other"))
+	require.ElementsMatch([]string{"/src/a", "/other"}, w.Dirs())
+	require.Len(names, 2)
+
+	var specs []interface{}
+	for _, args := range s.history() {
+		if args[0] == "subscribe" {
+			spec := args[3].(map[string]interface{})
+			specs = append(specs, spec["relative_root"])
+		}
+	}
+	require.Equal([]interface{}{"a", nil}, specs)
+
+	for i, name := range names {
+		s.send(protocol.ResponsePDU{
+			"unilateral":   true,
+			"subscription": name,
+			"clock":        "c:1531594843:978:9:2",
+			"files": []interface{}{
+				map[string]interface{}{
+					"name": "x/main.go", "type": "f", "size": i, "exists": true,
+					"cclock": "c:1531594843:978:9:1",
+				},
+			},
+		})
+	}
+	// each subscription is buffered separately, so order may vary
+	var files []string
+	for range names {
+		cn := (<-w.Notifications()).(*ChangeNotification)
+		files = append(files, cn.Files[0].Name)
+	}
+	require.ElementsMatch([]string{
+		filepath.FromSlash("/src/a/x/main.go"),
+		filepath.FromSlash("/other/x/main.go"),
+	}, files)
+
+	require.NoError(w.Close())
+	_, ok := <-w.Notifications()
+	require.False(ok)
+	require.Equal(ErrClosed, w.Add("/elsewhere"))
+	require.Equal(
+		[]string{"list-capabilities",
+			"watch-project", "subscribe",
+			"watch-project",
+			"watch-project", "subscribe",
+			"unsubscribe", "unsubscribe",
+		},
+		s.historyOf(0),
+	)
+}
+
+func TestWatcherDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeServer(t)
+	s.handle("watch-project", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{"watch": args[1]}
+	})
+	s.handle("subscribe", func(args []interface{}) protocol.ResponsePDU {
+		return protocol.ResponsePDU{
+			"clock":     "c:1531594843:978:9:1",
+			"subscribe": args[2],
+		}
+	})
+
+	c := s.connect()
+	defer c.Close()
+
+	w := c.NewWatcher()
+	require.NoError(w.Add("/tmp"))
+
+	s.close()
+	select {
+	case _, ok := <-w.Notifications():
+		require.False(ok)
+	case <-time.After(time.Second):
+		require.Fail("notifications not closed")
+	}
+	require.Error(w.Close())
+}
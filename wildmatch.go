@@ -0,0 +1,182 @@
+package watchman
+
+import (
+	"errors"
+	"strings"
+)
+
+// wildmatch reports whether name matches a pattern using the same rules
+// as the Watchman server, which are based on git's wildmatch:
+//
+//	?       matches a single character, except "/" if pathname
+//	*       matches any sequence of characters, except "/" if pathname
+//	**      matches across directories if pathname
+//	[a-z]   matches a character in a class, negated by "!" or "^"
+//	\c      matches c literally
+//
+// If period is true, wildcards do not match a leading "." in a name, or
+// in any directory component if pathname is also true. A malformed class
+// is matched literally.
+func wildmatch(pattern, name string, pathname, period, nocase bool) bool {
+	if nocase {
+		pattern = strings.ToLower(pattern)
+		name = strings.ToLower(name)
+	}
+	m := &wildmatcher{
+		pattern:  pattern,
+		name:     name,
+		pathname: pathname,
+		period:   period,
+	}
+	return m.match(0, 0)
+}
+
+// checkPattern reports syntax that wildmatch cannot interpret as
+// intended: an unclosed class, or a trailing backslash.
+func checkPattern(pattern string) error {
+	for p := 0; p < len(pattern); p++ {
+		switch pattern[p] {
+		case '\\':
+			if p+1 >= len(pattern) {
+				return errors.New("trailing backslash")
+			}
+			p++
+		case '[':
+			next, _, ok := matchClass(pattern, p, 0)
+			if !ok {
+				return errors.New("unclosed character class")
+			}
+			p = next - 1
+		}
+	}
+	return nil
+}
+
+type wildmatcher struct {
+	pattern  string
+	name     string
+	pathname bool
+	period   bool
+}
+
+// hidden reports whether name[i] is a "." that wildcards must not match.
+func (m *wildmatcher) hidden(i int) bool {
+	if !m.period || i >= len(m.name) || m.name[i] != '.' {
+		return false
+	}
+	return i == 0 || (m.pathname && m.name[i-1] == '/')
+}
+
+// separator reports whether name[i] cannot be matched by "*" or "?".
+func (m *wildmatcher) separator(i int) bool {
+	return m.pathname && m.name[i] == '/'
+}
+
+func (m *wildmatcher) match(p, n int) bool {
+	pattern, name := m.pattern, m.name
+	for p < len(pattern) {
+		switch c := pattern[p]; c {
+		case '?':
+			if n >= len(name) || m.separator(n) || m.hidden(n) {
+				return false
+			}
+			p++
+			n++
+		case '*':
+			start := p
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			// "**" only matches across directories if it is a whole
+			// path component, otherwise it is the same as "*"
+			doublestar := m.pathname && p-start > 1 &&
+				(start == 0 || pattern[start-1] == '/') &&
+				(p == len(pattern) || pattern[p] == '/')
+			if doublestar {
+				// "**/" also matches zero directories
+				if p < len(pattern) && m.match(p+1, n) {
+					return true
+				}
+			}
+			for i := n; ; i++ {
+				if m.match(p, i) {
+					return true
+				}
+				if i >= len(name) || m.hidden(i) {
+					return false
+				}
+				if !doublestar && m.separator(i) {
+					return false
+				}
+			}
+		case '[':
+			if n >= len(name) || m.separator(n) || m.hidden(n) {
+				return false
+			}
+			next, matched, ok := matchClass(pattern, p, name[n])
+			if !ok {
+				// malformed, so match "[" literally
+				if name[n] != '[' {
+					return false
+				}
+				p++
+				n++
+				continue
+			}
+			if !matched {
+				return false
+			}
+			p = next
+			n++
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+				c = pattern[p]
+			}
+			fallthrough
+		default:
+			if n >= len(name) || name[n] != c {
+				return false
+			}
+			p++
+			n++
+		}
+	}
+	return n == len(name)
+}
+
+// matchClass matches c against the class starting at pattern[start],
+// returning the position after the class. The class is malformed if it
+// is not closed.
+func matchClass(pattern string, start int, c byte) (next int, matched, ok bool) {
+	p := start + 1
+	negate := false
+	if p < len(pattern) && (pattern[p] == '!' || pattern[p] == '^') {
+		negate = true
+		p++
+	}
+	for first := true; p < len(pattern); first = false {
+		lo := pattern[p]
+		if lo == ']' && !first {
+			return p + 1, matched != negate, true
+		}
+		if lo == '\\' && p+1 < len(pattern) {
+			p++
+			lo = pattern[p]
+		}
+		p++
+		hi := lo
+		if p+1 < len(pattern) && pattern[p] == '-' && pattern[p+1] != ']' {
+			hi = pattern[p+1]
+			if hi == '\\' && p+2 < len(pattern) {
+				p++
+				hi = pattern[p+1]
+			}
+			p += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return 0, false, false
+}
@@ -0,0 +1,73 @@
+package watchman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWildmatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern  string
+		name     string
+		pathname bool
+		period   bool
+		nocase   bool
+		expected bool
+	}{
+		{"*.go", "main.go", false, true, false, true},
+		{"*.go", "main.c", false, true, false, false},
+		{"*.GO", "main.go", false, true, false, false},
+		{"*.GO", "main.go", false, true, true, true},
+		{"*", ".git", false, true, false, false},
+		{"*", ".git", false, false, false, true},
+		{".*", ".git", false, true, false, true},
+		{"?.go", "a.go", false, true, false, true},
+		{"?.go", "ab.go", false, true, false, false},
+		{"[abc].go", "b.go", false, true, false, true},
+		{"[!abc].go", "b.go", false, true, false, false},
+		{"[^abc].go", "d.go", false, true, false, true},
+		{"[a-c]x", "bx", false, true, false, true},
+		{"[]]", "]", false, true, false, true},
+		{"[a-", "[a-", false, true, false, true},
+		{`\*`, "*", false, true, false, true},
+		{`\*`, "a", false, true, false, false},
+		{"src/*.go", "src/main.go", true, true, false, true},
+		{"src/*.go", "src/cmd/main.go", true, true, false, false},
+		{"src/*.go", "src/cmd/main.go", false, true, false, true},
+		{"src/**/*.go", "src/main.go", true, true, false, true},
+		{"src/**/*.go", "src/cmd/x/main.go", true, true, false, true},
+		{"src/**/*.go", "src/.hidden/main.go", true, true, false, false},
+		{"src/**/*.go", "src/.hidden/main.go", true, false, false, true},
+		{"**", "a/b/c", true, true, false, true},
+		{"**/c", "c", true, true, false, true},
+		{"a/?", "a/b", true, true, false, true},
+		{"a?b", "a/b", true, true, false, false},
+		// from git's t3070-wildmatch.sh
+		{"a**b", "axb", true, true, false, true},
+		{"a**b", "a/x/b", true, true, false, false},
+		{"a**/b", "a/x/b", true, true, false, false},
+		{"a/**b", "a/x/b", true, true, false, false},
+		{"**/foo", "foo", true, true, false, true},
+		{"**/foo", "x/foo", true, true, false, true},
+		{"**/foo", "x/y/foo", true, true, false, true},
+		{"**/foo", "xfoo", true, true, false, false},
+		{"**/foo", "x/bfoo", true, true, false, false},
+		{"foo/**", "foo/a/b", true, true, false, true},
+		{"foo/**", "foo", true, true, false, false},
+		{"foo/**/bar", "foo/bar", true, true, false, true},
+		{"foo/**/bar", "foo/a/b/bar", true, true, false, true},
+	} {
+		actual := wildmatch(tc.pattern, tc.name, tc.pathname, tc.period, tc.nocase)
+		require.Equal(t, tc.expected, actual, "%q %q", tc.pattern, tc.name)
+	}
+}
+
+func TestCheckPattern(t *testing.T) {
+	for _, tc := range []string{"*.go", "**/*.go", "[]]", "[!a-z]", `\*`, "src/**"} {
+		require.NoError(t, checkPattern(tc), tc)
+	}
+	for _, tc := range []string{"[a-", "[", "[]", `*.go\`, `[\`} {
+		require.Error(t, checkPattern(tc), tc)
+	}
+}